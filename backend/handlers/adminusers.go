@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUserPageSize = 25
+	maxUserPageSize     = 100
+)
+
+// rejectIfSuspended answers 403 if staff have suspended the account
+func rejectIfSuspended(c *gin.Context, user *models.User) bool {
+	if user.SuspendedAt == nil {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":     "This account has been suspended. Contact support if you think this is a mistake.",
+		"suspended": true,
+	})
+	return true
+}
+
+// AdminListUsers searches users by name or email. Filters: role (a role
+// name, or "none" for customers) and status (active, suspended, locked,
+// unverified).
+func (h *AuthHandler) AdminListUsers(c *gin.Context) {
+	page, ok := parsePositiveInt(c.DefaultQuery("page", "1"))
+	if !ok {
+		page = 1
+	}
+	pageSize, ok := parsePositiveInt(c.DefaultQuery("page_size", fmt.Sprint(defaultUserPageSize)))
+	if !ok || pageSize > maxUserPageSize {
+		pageSize = defaultUserPageSize
+	}
+
+	query := h.DB.Model(&models.User{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		like := "%" + strings.ToLower(q) + "%"
+		query = query.Where("LOWER(email) LIKE ? OR LOWER(first_name) LIKE ? OR LOWER(last_name) LIKE ? OR LOWER(first_name || ' ' || last_name) LIKE ?",
+			like, like, like, like)
+	}
+	switch role := c.Query("role"); role {
+	case "":
+	case "none":
+		query = query.Where("id NOT IN (SELECT user_id FROM user_roles)")
+	default:
+		query = query.Where("id IN (SELECT user_roles.user_id FROM user_roles JOIN roles ON roles.id = user_roles.role_id WHERE roles.name = ?)", role)
+	}
+	switch c.Query("status") {
+	case "active":
+		query = query.Where("suspended_at IS NULL")
+	case "suspended":
+		query = query.Where("suspended_at IS NOT NULL")
+	case "locked":
+		query = query.Where("locked_until > ?", time.Now())
+	case "unverified":
+		query = query.Where("email_verified = ?", false)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var users []models.User
+	err := query.Preload("Credits").Preload("Roles").
+		Order("created_at desc").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&users).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":     users,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// AdminGetUser returns one user with their recent orders, transactions and
+// the audit trail of staff actions taken on the account
+func (h *AuthHandler) AdminGetUser(c *gin.Context) {
+	var user models.User
+	if err := h.DB.Preload("Credits").Preload("Roles").First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var orders []models.Order
+	h.DB.Where("user_id = ?", user.ID).Order("created_at desc").Limit(50).Find(&orders)
+	orderList := make([]gin.H, 0, len(orders))
+	for _, order := range orders {
+		orderList = append(orderList, gin.H{
+			"id":                order.ID,
+			"original_filename": order.OriginalFilename,
+			"status":            order.Status,
+			"priority":          order.Priority,
+			"ai_score":          order.AIScore,
+			"sim_score":         order.SimScore,
+			"created_at":        order.CreatedAt,
+		})
+	}
+
+	var transactions []models.Transaction
+	h.DB.Where("user_id = ?", user.ID).Order("created_at desc").Limit(50).Find(&transactions)
+
+	var audit []models.AuditLog
+	h.DB.Where("target_type = ? AND target_id = ?", "user", user.ID).Order("created_at desc").Limit(50).Find(&audit)
+
+	var activeSessions int64
+	h.DB.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).Count(&activeSessions)
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":            user,
+		"has_password":    user.PasswordHash != "",
+		"active_sessions": activeSessions,
+		"orders":          orderList,
+		"transactions":    transactions,
+		"audit":           audit,
+	})
+}
+
+// AdminSuspendUser blocks an account and signs it out everywhere. Suspending
+// staff needs roles.manage, so support can't lock out their managers.
+func (h *AuthHandler) AdminSuspendUser(c *gin.Context) {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if c.BindJSON(&body) != nil || strings.TrimSpace(body.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.Preload("Roles").First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	actorID, _ := c.Get("userID")
+	if uint(actorID.(float64)) == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't suspend your own account"})
+		return
+	}
+	if len(user.Roles) > 0 && !userCan(h.DB, actorID, models.PermRolesManage) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only role managers can suspend staff accounts"})
+		return
+	}
+	if user.SuspendedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already suspended"})
+		return
+	}
+
+	now := time.Now()
+	reason := strings.TrimSpace(body.Reason)
+	err := h.DB.Model(&user).Updates(map[string]interface{}{"suspended_at": now, "suspended_reason": reason}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to suspend user"})
+		return
+	}
+	revokeUserSessions(h.DB, user.ID)
+	recordAuditChange(c, h.DB, "user.suspend", "user", user.ID,
+		gin.H{"suspended_at": nil, "suspended_reason": ""}, gin.H{"suspended_at": now, "suspended_reason": reason}, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User suspended", "suspended_at": now, "suspended_reason": reason})
+}
+
+// AdminUnsuspendUser lets a suspended account sign in again. Like
+// suspending, it needs roles.manage for staff accounts.
+func (h *AuthHandler) AdminUnsuspendUser(c *gin.Context) {
+	var user models.User
+	if err := h.DB.Preload("Roles").First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	actorID, _ := c.Get("userID")
+	if len(user.Roles) > 0 && !userCan(h.DB, actorID, models.PermRolesManage) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only role managers can unsuspend staff accounts"})
+		return
+	}
+	if user.SuspendedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is not suspended"})
+		return
+	}
+
+	err := h.DB.Model(&user).Updates(map[string]interface{}{"suspended_at": nil, "suspended_reason": ""}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsuspend user"})
+		return
+	}
+	recordAuditChange(c, h.DB, "user.unsuspend", "user", user.ID,
+		gin.H{"suspended_at": user.SuspendedAt, "suspended_reason": user.SuspendedReason}, gin.H{"suspended_at": nil, "suspended_reason": ""}, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unsuspended"})
+}
+
+// AdminAdjustSlots adds (positive delta) or removes (negative delta) slots
+// by hand, e.g. as a goodwill credit or to reverse a mistaken grant
+func (h *AuthHandler) AdminAdjustSlots(c *gin.Context) {
+	var body struct {
+		Delta  int    `json:"delta"`
+		Reason string `json:"reason"`
+	}
+	if c.BindJSON(&body) != nil || body.Delta == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A non-zero number of slots is required"})
+		return
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var credits models.UserCredits
+	errInsufficient := errors.New("insufficient slots")
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(models.UserCredits{UserID: user.ID}).FirstOrCreate(&credits).Error; err != nil {
+			return err
+		}
+		// The balance check is part of the update, so a concurrent spend or
+		// adjustment can't take it below zero
+		result := tx.Model(&models.UserCredits{}).Where("user_id = ? AND slots_remaining + ? >= 0", user.ID, body.Delta).
+			UpdateColumn("slots_remaining", gorm.Expr("slots_remaining + ?", body.Delta))
+		if result.Error != nil {
+			return result.Error
+		}
+		if err := tx.Where("user_id = ?", user.ID).First(&credits).Error; err != nil {
+			return err
+		}
+		if result.RowsAffected != 1 {
+			return errInsufficient
+		}
+		return nil
+	})
+	if errors.Is(err, errInsufficient) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("User only has %d slot(s)", credits.SlotsRemaining)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update slots"})
+		return
+	}
+
+	after := credits.SlotsRemaining
+	before := after - body.Delta
+	recordAuditChange(c, h.DB, "credits.adjust", "user", user.ID,
+		gin.H{"slots_remaining": before}, gin.H{"slots_remaining": after},
+		gin.H{"delta": body.Delta, "reason": reason})
+
+	c.JSON(http.StatusOK, gin.H{"slots_remaining": after})
+}
+
+// AdminSendPasswordReset emails the user a password reset link
+func (h *AuthHandler) AdminSendPasswordReset(c *gin.Context) {
+	var user models.User
+	if err := h.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	err := sendPasswordReset(h.DB, user.Email)
+	if errors.Is(err, errSMTPNotConfigured) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Config Error: SMTP Missing"})
+		return
+	}
+	if err != nil {
+		fmt.Println("SMTP Error:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email: " + err.Error()})
+		return
+	}
+	recordAudit(c, h.DB, "user.password_reset", "user", user.ID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset link sent to " + user.Email})
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// claimLease is how long an admin holds an order before others may take it over
+func claimLease() time.Duration {
+	return time.Duration(envInt("ORDER_CLAIM_LEASE_MINUTES", 30)) * time.Minute
+}
+
+// claimOrder atomically assigns an order to an admin. It only succeeds when the
+// order is unassigned, already held by the same admin, or the previous lease expired.
+func claimOrder(db *gorm.DB, orderID uint, adminID uint) (bool, error) {
+	now := time.Now()
+	expires := now.Add(claimLease())
+
+	result := db.Model(&models.Order{}).
+		Where("id = ? AND status <> ?", orderID, models.StatusCompleted).
+		Where("(assigned_to IS NULL AND worker_id IS NULL) OR assigned_to = ? OR claim_expires_at < ?", adminID, now).
+		Updates(map[string]interface{}{
+			"assigned_to":      adminID,
+			"claimed_at":       gorm.Expr("CASE WHEN assigned_to = ? THEN claimed_at ELSE ? END", adminID, now),
+			"claim_expires_at": expires,
+			"worker_id":        nil,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// heldByOther reports whether another admin or a worker holds a live claim
+func heldByOther(order models.Order, adminID uint) bool {
+	heldElsewhere := (order.AssignedTo != nil && *order.AssignedTo != adminID) || order.WorkerID != nil
+	return heldElsewhere && order.ClaimExpiresAt != nil && order.ClaimExpiresAt.After(time.Now())
+}
+
+// AdminClaimOrder claims (or renews the claim on) an order for the calling admin
+func (h *OrderHandler) AdminClaimOrder(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	adminID := uint(userID.(float64))
+
+	var order models.Order
+	if err := h.DB.First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	claimed, err := claimOrder(h.DB, order.ID, adminID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim order"})
+		return
+	}
+	if !claimed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order is already claimed by another admin or completed"})
+		return
+	}
+
+	before := orderAuditState(order)
+	h.DB.Preload("Assignee").First(&order, order.ID)
+	recordAuditChange(c, h.DB, "order.claim", "order", order.ID, before, orderAuditState(order), nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Order claimed", "order": order})
+}
+
+// AdminReleaseOrder gives up the calling admin's claim so others can pick it
+// up. An order that was being processed goes back to pending, where "start
+// processing" can claim it again.
+func (h *OrderHandler) AdminReleaseOrder(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	adminID := uint(userID.(float64))
+
+	var order models.Order
+	if err := h.DB.First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	before := orderAuditState(order)
+
+	result := h.DB.Model(&models.Order{}).
+		Where("id = ? AND assigned_to = ?", order.ID, adminID).
+		Updates(map[string]interface{}{
+			"status":           gorm.Expr("CASE WHEN status = ? THEN ? ELSE status END", models.StatusProcessing, models.StatusPending),
+			"assigned_to":      nil,
+			"claimed_at":       nil,
+			"claim_expires_at": nil,
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release order"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "You do not hold a claim on this order"})
+		return
+	}
+	h.DB.First(&order, order.ID)
+	recordAuditChange(c, h.DB, "order.release", "order", order.ID, before, orderAuditState(order), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order released"})
+}
+
+// AdminReassignOrder hands an order to another admin (or unassigns it with admin_id 0)
+func (h *OrderHandler) AdminReassignOrder(c *gin.Context) {
+	var body struct {
+		AdminID uint `json:"admin_id"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var order models.Order
+	if err := h.DB.First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.Status == models.StatusCompleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order is already completed"})
+		return
+	}
+
+	updates := map[string]interface{}{
+		"assigned_to":      nil,
+		"claimed_at":       nil,
+		"claim_expires_at": nil,
+		"worker_id":        nil,
+	}
+	if body.AdminID != 0 {
+		var target models.User
+		if err := h.DB.Preload("Roles").First(&target, body.AdminID).Error; err != nil || !target.HasPermission(models.PermOrdersProcess) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Target user cannot process orders"})
+			return
+		}
+		now := time.Now()
+		updates["assigned_to"] = body.AdminID
+		updates["claimed_at"] = now
+		updates["claim_expires_at"] = now.Add(claimLease())
+	}
+
+	before := orderAuditState(order)
+	if err := h.DB.Model(&order).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reassign order"})
+		return
+	}
+
+	h.DB.Preload("Assignee").First(&order, order.ID)
+	recordAuditChange(c, h.DB, "order.reassign", "order", order.ID, before, orderAuditState(order), nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Order reassigned", "order": order})
+}
+
+// AdminOperatorStats returns per-admin throughput over the last `days` days (default 30)
+func (h *OrderHandler) AdminOperatorStats(c *gin.Context) {
+	days := 30
+	if d, ok := parsePositiveInt(c.Query("days")); ok {
+		days = d
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	var orders []models.Order
+	h.DB.Where("status = ? AND completed_by IS NOT NULL AND completed_at >= ?", models.StatusCompleted, since).Find(&orders)
+
+	type operatorStats struct {
+		AdminID              uint    `json:"admin_id"`
+		Name                 string  `json:"name"`
+		Email                string  `json:"email"`
+		Completed            int     `json:"completed"`
+		SLAMet               int     `json:"sla_met"`
+		AvgProcessingMinutes float64 `json:"avg_processing_minutes"`
+		totalMinutes         float64
+		timed                int
+	}
+
+	byAdmin := make(map[uint]*operatorStats)
+	for _, order := range orders {
+		s, ok := byAdmin[*order.CompletedBy]
+		if !ok {
+			s = &operatorStats{AdminID: *order.CompletedBy}
+			byAdmin[*order.CompletedBy] = s
+		}
+		s.Completed++
+		if order.SLAMet != nil && *order.SLAMet {
+			s.SLAMet++
+		}
+		if order.ClaimedAt != nil && order.CompletedAt != nil {
+			s.totalMinutes += order.CompletedAt.Sub(*order.ClaimedAt).Minutes()
+			s.timed++
+		}
+	}
+
+	response := []operatorStats{}
+	for id, s := range byAdmin {
+		var admin models.User
+		if err := h.DB.Unscoped().First(&admin, id).Error; err == nil {
+			s.Name = admin.FirstName + " " + admin.LastName
+			s.Email = admin.Email
+		}
+		if s.timed > 0 {
+			s.AvgProcessingMinutes = s.totalMinutes / float64(s.timed)
+		}
+		response = append(response, *s)
+	}
+	sort.Slice(response, func(i, j int) bool { return response[i].Completed > response[j].Completed })
+
+	c.JSON(http.StatusOK, gin.H{"days": days, "operators": response})
+}
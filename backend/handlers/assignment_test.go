@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"checkmate-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReleasedOrderCanBeStartedAgain(t *testing.T) {
+	db := newTestDB(t)
+	order := models.Order{UserID: 1, Status: models.StatusPending}
+	db.Create(&order)
+	h := NewOrderHandler(db, nil)
+
+	call := func(adminID uint, path string, handler gin.HandlerFunc) int {
+		r := gin.New()
+		r.POST("/orders/:id/"+path, signedInAs(adminID), handler)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders/1/"+path, nil))
+		return w.Code
+	}
+
+	if code := call(10, "start", h.AdminStartProcessing); code != http.StatusOK {
+		t.Fatalf("start processing: %d", code)
+	}
+	if code := call(10, "release", h.AdminReleaseOrder); code != http.StatusOK {
+		t.Fatalf("release: %d", code)
+	}
+	db.First(&order, order.ID)
+	if order.Status != models.StatusPending || order.AssignedTo != nil {
+		t.Fatalf("after release: status %s, assigned to %v", order.Status, order.AssignedTo)
+	}
+	if code := call(11, "start", h.AdminStartProcessing); code != http.StatusOK {
+		t.Fatalf("second admin could not start the released order: %d", code)
+	}
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxAuditExportRows caps a single CSV export
+const maxAuditExportRows = 50000
+
+// auditIgnoredFields change on every save and would drown out real changes
+var auditIgnoredFields = map[string]bool{"created_at": true, "updated_at": true}
+
+type AuditHandler struct {
+	DB *gorm.DB
+}
+
+func NewAuditHandler(db *gorm.DB) *AuditHandler {
+	return &AuditHandler{DB: db}
+}
+
+// auditEmail stands in for an email address in audit details. Entries can't
+// be changed, so a raw address would outlive the account's deletion; a keyed
+// hash still lets staff search for a known address (the email filter).
+func auditEmail(email string) string {
+	mac := hmac.New(sha256.New, hashKey("AUDIT_HASH_KEY", "audit-email"))
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// writeAudit appends one entry. Failing to write it is logged but never
+// blocks the action itself.
+func writeAudit(c *gin.Context, db *gorm.DB, entry models.AuditLog) {
+	if c != nil {
+		entry.IP = c.ClientIP()
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		fmt.Printf("[AUDIT] Failed to record %s on %s %d: %v\n", entry.Action, entry.TargetType, entry.TargetID, err)
+	}
+}
+
+// auditActor is the signed-in user, or the staff member impersonating them
+func auditActor(c *gin.Context, details gin.H) (uint, gin.H) {
+	var actorID uint
+	if userID, ok := c.Get("userID"); ok {
+		if id, ok := userID.(float64); ok {
+			actorID = uint(id)
+		}
+	}
+	if impersonator, ok := c.Get("impersonatorID"); ok {
+		if details == nil {
+			details = gin.H{}
+		}
+		details["impersonating_user"] = actorID
+		actorID = impersonator.(uint)
+	}
+	return actorID, details
+}
+
+// recordAudit appends an entry for an action taken by the signed-in user
+func recordAudit(c *gin.Context, db *gorm.DB, action, targetType string, targetID uint, details gin.H) {
+	actorID, details := auditActor(c, details)
+	writeAudit(c, db, models.AuditLog{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    details,
+	})
+}
+
+// recordAuditChange appends an entry with the fields that differ between
+// before and after. Pass nil for before on create and for after on delete.
+func recordAuditChange(c *gin.Context, db *gorm.DB, action, targetType string, targetID uint, before, after interface{}, details gin.H) {
+	actorID, details := auditActor(c, details)
+	writeAudit(c, db, models.AuditLog{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    details,
+		Changes:    auditDiff(before, after),
+	})
+}
+
+// recordSecurityEvent logs something that happened to a user's account
+// before they are signed in (logins, lockouts, password resets)
+func recordSecurityEvent(c *gin.Context, db *gorm.DB, userID uint, action string, details gin.H) {
+	writeAudit(c, db, models.AuditLog{
+		ActorID:    userID,
+		Action:     action,
+		TargetType: "user",
+		TargetID:   userID,
+		Details:    details,
+	})
+}
+
+// auditDiff compares two values by their JSON form, so fields hidden from
+// the API (password hashes, secrets) never reach the log
+func auditDiff(before, after interface{}) gin.H {
+	from, to := auditFields(before), auditFields(after)
+	changes := gin.H{}
+	for key, next := range to {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		if prev, ok := from[key]; !ok || !reflect.DeepEqual(prev, next) {
+			changes[key] = gin.H{"from": from[key], "to": next}
+		}
+	}
+	for key, prev := range from {
+		if _, ok := to[key]; !ok && !auditIgnoredFields[key] {
+			changes[key] = gin.H{"from": prev, "to": nil}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+func auditFields(value interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if value == nil {
+		return fields
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(raw, &fields)
+	return fields
+}
+
+// auditQuery applies the filters shared by the list and the export:
+// actor_id, action (a trailing "." matches a whole family, e.g. "user."),
+// target_type, target_id, ip, email (entries mentioning the address), and
+// from/to as dates or RFC 3339 times
+func (h *AuditHandler) auditQuery(c *gin.Context) (*gorm.DB, bool) {
+	query := h.DB.Model(&models.AuditLog{})
+	if actor := c.Query("actor_id"); actor != "" {
+		query = query.Where("actor_id = ?", actor)
+	}
+	if action := c.Query("action"); strings.HasSuffix(action, ".") {
+		query = query.Where("action LIKE ?", action+"%")
+	} else if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+	if ip := c.Query("ip"); ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+	if email := c.Query("email"); email != "" {
+		hash := "%" + auditEmail(email) + "%"
+		query = query.Where("details LIKE ? OR changes LIKE ?", hash, hash)
+	}
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<"}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			day, dayErr := time.Parse("2006-01-02", value)
+			if dayErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Dates must be YYYY-MM-DD or RFC 3339"})
+				return nil, false
+			}
+			at = day
+			if bound.param == "to" {
+				at = day.AddDate(0, 0, 1) // Include the whole day
+			}
+		}
+		query = query.Where("created_at "+bound.op+" ?", at)
+	}
+	return query, true
+}
+
+// actorEmails looks up who the actors were, including deleted accounts
+func (h *AuditHandler) actorEmails(entries []models.AuditLog) map[uint]string {
+	ids := []uint{}
+	for _, entry := range entries {
+		if entry.ActorID != 0 {
+			ids = append(ids, entry.ActorID)
+		}
+	}
+	emails := map[uint]string{}
+	if len(ids) == 0 {
+		return emails
+	}
+	var users []models.User
+	h.DB.Unscoped().Select("id", "email").Where("id IN ?", ids).Find(&users)
+	for _, user := range users {
+		emails[user.ID] = user.Email
+	}
+	return emails
+}
+
+// AdminListAudit returns audit entries, newest first, a page at a time
+func (h *AuditHandler) AdminListAudit(c *gin.Context) {
+	query, ok := h.auditQuery(c)
+	if !ok {
+		return
+	}
+	page, ok := parsePositiveInt(c.DefaultQuery("page", "1"))
+	if !ok {
+		page = 1
+	}
+	pageSize, ok := parsePositiveInt(c.DefaultQuery("page_size", "50"))
+	if !ok || pageSize > 200 {
+		pageSize = 50
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var entries []models.AuditLog
+	if err := query.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	emails := h.actorEmails(entries)
+	results := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		results = append(results, gin.H{
+			"id":          entry.ID,
+			"actor_id":    entry.ActorID,
+			"actor_email": emails[entry.ActorID],
+			"action":      entry.Action,
+			"target_type": entry.TargetType,
+			"target_id":   entry.TargetID,
+			"details":     entry.Details,
+			"changes":     entry.Changes,
+			"ip":          entry.IP,
+			"created_at":  entry.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": results, "total": total, "page": page, "page_size": pageSize})
+}
+
+// AdminExportAudit downloads the filtered audit log as CSV, oldest first
+func (h *AuditHandler) AdminExportAudit(c *gin.Context) {
+	query, ok := h.auditQuery(c)
+	if !ok {
+		return
+	}
+	var entries []models.AuditLog
+	if err := query.Order("id asc").Limit(maxAuditExportRows).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export audit log"})
+		return
+	}
+	emails := h.actorEmails(entries)
+
+	// Exports are themselves audited
+	recordAudit(c, h.DB, "audit.export", "audit", 0, gin.H{"filters": c.Request.URL.RawQuery, "rows": len(entries)})
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.csv"`, time.Now().Format("20060102-150405")))
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "time", "actor_id", "actor_email", "action", "target_type", "target_id", "ip", "details", "changes"})
+	for _, entry := range entries {
+		w.Write(csvRow(
+			fmt.Sprint(entry.ID),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			fmt.Sprint(entry.ActorID),
+			emails[entry.ActorID],
+			entry.Action,
+			entry.TargetType,
+			fmt.Sprint(entry.TargetID),
+			entry.IP,
+			csvJSON(entry.Details),
+			csvJSON(entry.Changes),
+		))
+	}
+	w.Flush()
+}
+
+// csvRow neutralises cells a spreadsheet would run as a formula. Actor names,
+// reasons and other details are user-controlled, so a leading =, +, - or @
+// gets a quote in front.
+func csvRow(cells ...string) []string {
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cells[i] = "'" + cell
+		}
+	}
+	return cells
+}
+
+func csvJSON(value map[string]interface{}) string {
+	if len(value) == 0 {
+		return ""
+	}
+	raw, _ := json.Marshal(value)
+	return string(raw)
+}
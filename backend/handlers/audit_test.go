@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"checkmate-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuditExportNeutralisesFormulas(t *testing.T) {
+	db := newTestDB(t)
+	actor := models.User{Email: "=HYPERLINK(\"https://evil.example\")@example.com"}
+	db.Create(&actor)
+	db.Create(&models.AuditLog{ActorID: actor.ID, Action: "user.suspend", TargetType: "user", TargetID: 1, IP: "-1+1"})
+
+	r := gin.New()
+	r.GET("/export", signedInAs(actor.ID), NewAuditHandler(db).AdminExportAudit)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export?action=user.suspend", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want a header and one entry", len(rows))
+	}
+	for _, cell := range rows[1] {
+		if cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+			t.Fatalf("cell %q would run as a formula", cell)
+		}
+	}
+}
+
+func TestHashesDoNotUseTheSigningKey(t *testing.T) {
+	t.Setenv("JWT_SECRET", "signing-secret")
+	t.Setenv("AUDIT_HASH_KEY", "")
+	t.Setenv("OTP_HASH_KEY", "")
+
+	signed := func(message string) string {
+		mac := hmac.New(sha256.New, []byte("signing-secret"))
+		mac.Write([]byte(message))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	if hashOTP("u@example.com", "123456") == signed("u@example.com:123456") {
+		t.Fatal("OTP hash is keyed with JWT_SECRET")
+	}
+	if auditEmail("u@example.com") == signed("u@example.com")[:32] {
+		t.Fatal("audit email hash is keyed with JWT_SECRET")
+	}
+
+	t.Setenv("AUDIT_HASH_KEY", "audit-key")
+	mac := hmac.New(sha256.New, []byte("audit-key"))
+	mac.Write([]byte("u@example.com"))
+	if auditEmail("U@example.com ") != hex.EncodeToString(mac.Sum(nil))[:32] {
+		t.Fatal("AUDIT_HASH_KEY is not used")
+	}
+}
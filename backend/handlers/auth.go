@@ -2,62 +2,82 @@ package handlers
 
 import (
 	"checkmate-backend/models"
-	crand "crypto/rand"
-	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
+	"log"
 	"net/http"
-	"net/smtp"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	google *idTokenVerifier
 }
 
 func NewAuthHandler(db *gorm.DB) *AuthHandler {
-	return &AuthHandler{DB: db}
+	return &AuthHandler{DB: db, google: newGoogleVerifier()}
 }
 
+// newGoogleVerifier checks Sign in with Google ID tokens against Google's
+// published keys. GOOGLE_JWKS_URL can point at a local key set for testing.
+func newGoogleVerifier() *idTokenVerifier {
+	jwksURL := os.Getenv("GOOGLE_JWKS_URL")
+	if jwksURL == "" {
+		jwksURL = "https://www.googleapis.com/oauth2/v3/certs"
+	}
+	clientID := os.Getenv("GOOGLE_CLIENT_ID")
+	if clientID == "" {
+		log.Println("GOOGLE_CLIENT_ID is not set: Google sign-in is disabled")
+	}
+	return &idTokenVerifier{
+		issuers:  []string{"https://accounts.google.com", "accounts.google.com"},
+		clientID: clientID,
+		keys:     newJWKSCache(jwksURL),
+	}
+}
+
+// whereEmail matches users by address regardless of case, the way every
+// sign-in method looks accounts up
+func whereEmail(db *gorm.DB, email string) *gorm.DB {
+	return db.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email)))
+}
+
+// Signup creates an unverified account, emails a code to verify the address,
+// and signs the user in. Until the address is verified the account can't
+// make purchases.
 func (h *AuthHandler) Signup(c *gin.Context) {
 	var body struct {
 		FirstName string `json:"first_name"`
 		LastName  string `json:"last_name"`
 		Email     string `json:"email"`
 		Password  string `json:"password"`
-		Code      string `json:"code"`
 	}
 
 	if c.BindJSON(&body) != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read body"})
 		return
 	}
-
-	// Verify OTP
-	var vc models.VerificationCode
-	if err := h.DB.Where("email = ? AND code = ?", body.Email, body.Code).First(&vc).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification code"})
+	body.Email = strings.TrimSpace(body.Email)
+	if !strings.Contains(body.Email, "@") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enter a valid email address"})
 		return
 	}
-	if time.Now().After(vc.ExpiresAt) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification code expired"})
+
+	// Check if user already exists
+	var existingUser models.User
+	if err := whereEmail(h.DB.Select("id"), body.Email).First(&existingUser).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered. Please login, or reset your password if this is your address."})
 		return
 	}
-	// Consume Code
-	h.DB.Delete(&vc)
 
-	// Check if this is the defined admin email
-	adminEmail := os.Getenv("ADMIN_EMAIL")
-	isAdmin := false
-	if adminEmail != "" && body.Email == adminEmail {
-		isAdmin = true // Auto-promote if matches .env
+	if rejectWeakPassword(c, body.Password, body.Email) {
+		return
 	}
 
 	// Hash password
@@ -73,7 +93,6 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 		LastName:     body.LastName,
 		Email:        body.Email,
 		PasswordHash: string(hash),
-		IsAdmin:      isAdmin,
 	}
 
 	result := h.DB.Create(&user)
@@ -82,7 +101,12 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "User created successfully"})
+	// The account works without it, and the code can be sent again later
+	if err := sendVerificationCode(h.DB, user, user.Email); err != nil {
+		fmt.Println("SMTP Error:", err)
+	}
+
+	completeLogin(c, h.DB, user)
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -98,196 +122,144 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// Look up requested user
 	var user models.User
-	h.DB.First(&user, "email = ?", body.Email)
+	whereEmail(h.DB, body.Email).First(&user)
 
 	if user.ID == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
+	if rejectIfLocked(c, &user) {
+		return
+	}
+
 	// Compare pass
 	err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(body.Password))
 	if err != nil {
+		recordLoginFailure(c, h.DB, &user)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	// Auto-promote to admin if email matches ADMIN_EMAIL
-	adminEmail := os.Getenv("ADMIN_EMAIL")
-	if adminEmail != "" && user.Email == adminEmail && !user.IsAdmin {
-		user.IsAdmin = true
-		h.DB.Save(&user)
-	}
-
-	// Generate JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":   user.ID,
-		"email": user.Email,
-		"admin": user.IsAdmin,
-		"exp":   time.Now().Add(time.Hour * 24 * 30).Unix(),
-	})
-
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
-		return
+	// Auto-promote to superadmin if email matches ADMIN_EMAIL
+	if adminEmail := os.Getenv("ADMIN_EMAIL"); user.Email == adminEmail {
+		PromoteAdminEmail(h.DB, adminEmail)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": tokenString,
-		"user": gin.H{
-			"id":       user.ID,
-			"email":    user.Email,
-			"is_admin": user.IsAdmin,
-		},
-	})
-}
-
-// AdminListUsers returns all users with their credits
-func (h *AuthHandler) AdminListUsers(c *gin.Context) {
-	var users []models.User
-	// Preload Credits to get slot info
-	if err := h.DB.Preload("Credits").Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
-		return
-	}
-	c.JSON(http.StatusOK, users)
+	completeLogin(c, h.DB, user)
 }
 
-// SendOTP generates and emails a code
-func (h *AuthHandler) SendOTP(c *gin.Context) {
+// GoogleLogin handles Sign in with Google
+func (h *AuthHandler) GoogleLogin(c *gin.Context) {
 	var body struct {
-		Email string `json:"email"`
+		Credential string `json:"credential"`
 	}
 	if c.BindJSON(&body) != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing credential"})
 		return
 	}
 
-	// Check if user already exists
-	var existingUser models.User
-	if err := h.DB.Select("id").Where("email = ?", body.Email).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered. Please login."})
+	if h.google.clientID == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Google sign-in is not configured"})
 		return
 	}
 
-	// Generate 6 digit Code
-	code := fmt.Sprintf("%06d", rand.Intn(1000000))
-
-	// Delete old codes
-	h.DB.Where("email = ?", body.Email).Delete(&models.VerificationCode{})
-
-	// Save new code
-	vc := models.VerificationCode{
-		Email:     body.Email,
-		Code:      code,
-		ExpiresAt: time.Now().Add(10 * time.Minute),
-	}
-	if err := h.DB.Create(&vc).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save code"})
+	// Verify the ID token locally (signature, issuer, audience, expiry)
+	claims, err := h.google.verify(body.Credential)
+	if err != nil {
+		fmt.Println("Google token rejected:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Google Token"})
 		return
 	}
-
-	// Send Email via SMTP
-	from := os.Getenv("SMTP_EMAIL")
-	password := os.Getenv("SMTP_PASSWORD")
-	host := os.Getenv("SMTP_HOST")
-	port := os.Getenv("SMTP_PORT")
-
-	if from == "" || password == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "SMTP credentials missing in env"})
+	if !emailVerified(claims) || claimString(claims, "email") == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Your Google email address is not verified"})
 		return
 	}
+	email := claimString(claims, "email")
+	subject := claimString(claims, "sub")
 
-	msg := "From: " + from + "\n" +
-		"To: " + body.Email + "\n" +
-		"Subject: Checkmate Verification Code\n\n" +
-		"Your verification code is: " + code
-
-	auth := smtp.PlainAuth("", from, password, host)
-	err := smtp.SendMail(host+":"+port, auth, from, []string{body.Email}, []byte(msg))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email: " + err.Error()})
+	// A linked Google account signs in to its user, whatever its email is now
+	var user models.User
+	if identity, ok := findIdentity(h.DB, providerGoogle, subject, email); ok {
+		if err := h.DB.First(&user, identity.UserID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			return
+		}
+		completeLogin(c, h.DB, user)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Verification code sent"})
-}
-
-// GoogleLogin handles Sign in with Google
-func (h *AuthHandler) GoogleLogin(c *gin.Context) {
-	var body struct {
-		Credential string `json:"credential"`
-	}
-	if c.BindJSON(&body) != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing credential"})
+	if whereEmail(h.DB, email).First(&user).Error == nil {
+		// Google has verified the address, which the account never did
+		claimUnverifiedAccount(c, h.DB, &user)
+
+		// Accounts made by Google sign-in before identities were recorded have
+		// no password and no identities; anything else must prove ownership
+		// by signing in first and linking Google from there
+		var linked int64
+		h.DB.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Count(&linked)
+		if user.PasswordHash != "" || linked > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":         "An account with this email already exists. Sign in the way you usually do to link Google.",
+				"link_required": true,
+				"email":         user.Email,
+			})
+			return
+		}
+		if err := addIdentity(h.DB, user.ID, providerGoogle, subject, email); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link Google account"})
+			return
+		}
+		markEmailVerified(h.DB, &user)
+		completeLogin(c, h.DB, user)
 		return
 	}
 
-	// Verify ID Token with Google
-	resp, err := http.Get("https://oauth2.googleapis.com/tokeninfo?id_token=" + body.Credential)
+	// New user
+	user = models.User{
+		Email:         email,
+		FirstName:     claimString(claims, "given_name"),
+		LastName:      claimString(claims, "family_name"),
+		EmailVerified: true, // Google only accepts verified emails
+		PasswordHash:  "",   // Google only until they add a password
+		IsAdmin:       false,
+	}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return addIdentity(tx, user.ID, providerGoogle, subject, email)
+	})
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to connect to Google"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Google Token"})
-		return
-	}
+	completeLogin(c, h.DB, user)
+}
 
-	var claims struct {
-		Email      string `json:"email"`
-		Sub        string `json:"sub"`
-		GivenName  string `json:"given_name"`
-		FamilyName string `json:"family_name"`
-		Aud        string `json:"aud"`
+// sendPasswordReset replaces any outstanding reset link for the address and
+// emails a new one, valid for an hour
+func sendPasswordReset(db *gorm.DB, email string) error {
+	token, err := randomToken(32)
+	if err != nil {
+		return err
 	}
-	json.NewDecoder(resp.Body).Decode(&claims)
 
-	// Optional: Check Client ID
-	clientID := os.Getenv("GOOGLE_CLIENT_ID")
-	if clientID != "" && claims.Aud != clientID {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token audience mismatch"})
-		return
+	// Save Token (hash only, so a leaked database can't be used to reset passwords)
+	db.Where("email = ?", email).Delete(&models.PasswordResetToken{})
+	rt := models.PasswordResetToken{
+		Email:     email,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(1 * time.Hour),
 	}
-
-	// Find or Create User
-	var user models.User
-	h.DB.First(&user, "email = ?", claims.Email)
-
-	if user.ID == 0 {
-		user = models.User{
-			Email:        claims.Email,
-			FirstName:    claims.GivenName,
-			LastName:     claims.FamilyName,
-			PasswordHash: "", // No password
-			IsAdmin:      false,
-		}
-		if err := h.DB.Create(&user).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
-			return
-		}
+	if err := db.Create(&rt).Error; err != nil {
+		return err
 	}
 
-	// Generate JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":   user.ID,
-		"email": user.Email,
-		"admin": user.IsAdmin,
-		"exp":   time.Now().Add(time.Hour * 24 * 30).Unix(),
-	})
-	tokenString, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
-
-	c.JSON(http.StatusOK, gin.H{
-		"token": tokenString,
-		"user": gin.H{
-			"id":       user.ID,
-			"email":    user.Email,
-			"is_admin": user.IsAdmin,
-		},
-	})
+	link := appURL() + "/reset-password?token=" + token
+	return sendEmail(email, "Password Reset Request",
+		"Click link to reset password:\n\n"+link+"\n\nLink expires in 1 hour.")
 }
 
 // ForgotPassword handles reset request
@@ -302,58 +274,20 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 
 	// Check if user exists (silently proceed if not found for security, but log it)
 	var user models.User
-	if err := h.DB.Where("email = ?", body.Email).First(&user).Error; err != nil {
+	if err := whereEmail(h.DB, body.Email).First(&user).Error; err != nil {
 		fmt.Printf("DEBUG: User not found for email: %s\n", body.Email)
 		c.JSON(http.StatusOK, gin.H{"message": "Reset link sent"})
 		return
 	}
 
-	// Generate Token
-	bytes := make([]byte, 32)
-	crand.Read(bytes)
-	token := hex.EncodeToString(bytes)
+	fmt.Printf("DEBUG: Attempting to send password reset email to %s\n", body.Email)
 
-	// Save Token
-	h.DB.Where("email = ?", body.Email).Delete(&models.PasswordResetToken{})
-
-	rt := models.PasswordResetToken{
-		Email:     body.Email,
-		Token:     token,
-		ExpiresAt: time.Now().Add(1 * time.Hour),
-	}
-	h.DB.Create(&rt)
-
-	// Send Email
-	// Ideally use Env Var for Frontend URL
-	baseURL := os.Getenv("APP_URL")
-	if baseURL == "" {
-		baseURL = "https://checkmateturnit.icu"
-	}
-	link := baseURL + "/reset-password?token=" + token
-
-	from := os.Getenv("SMTP_EMAIL")
-	password := os.Getenv("SMTP_PASSWORD")
-	host := os.Getenv("SMTP_HOST")
-	port := os.Getenv("SMTP_PORT")
-
-	if from == "" || password == "" {
+	err := sendPasswordReset(h.DB, user.Email)
+	if errors.Is(err, errSMTPNotConfigured) {
 		fmt.Println("DEBUG: SMTP Credentials MISSING in .env")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Config Error: SMTP Missing"})
 		return
 	}
-
-	msg := "From: " + from + "\n" +
-		"To: " + body.Email + "\n" +
-		"Subject: Password Reset Request\n\n" +
-		"Click link to reset password:\n\n" +
-		link + "\n\n" +
-		"Link expires in 1 hour."
-
-	auth := smtp.PlainAuth("", from, password, host)
-
-	fmt.Printf("DEBUG: Attempting to send email to %s via %s:%s\n", body.Email, host, port)
-
-	err := smtp.SendMail(host+":"+port, auth, from, []string{body.Email}, []byte(msg))
 	if err != nil {
 		fmt.Println("SMTP Error:", err) // Print to server logs
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email: " + err.Error()})
@@ -374,28 +308,58 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	// Verify Token
+	// Verify Token (looked up by hash; the raw token is never stored)
 	var rt models.PasswordResetToken
-	if err := h.DB.Where("token = ?", body.Token).First(&rt).Error; err != nil {
+	if err := h.DB.Where("token_hash = ?", hashToken(body.Token)).First(&rt).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
 		return
 	}
 
 	if time.Now().After(rt.ExpiresAt) {
+		h.DB.Delete(&rt)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Token expired"})
 		return
 	}
 
+	if rejectWeakPassword(c, body.NewPassword, rt.Email) {
+		return
+	}
+
 	// Update User Password
-	hash, _ := bcrypt.GenerateFromPassword([]byte(body.NewPassword), 10)
+	hash, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), 10)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to hash password"})
+		return
+	}
 
-	if err := h.DB.Model(&models.User{}).Where("email = ?", rt.Email).Update("password_hash", string(hash)).Error; err != nil {
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		// Consume Token first: only one request can delete it
+		result := tx.Where("id = ?", rt.ID).Delete(&models.PasswordResetToken{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&models.User{}).Where("email = ?", rt.Email).Update("password_hash", string(hash)).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
 
-	// Consume Token
-	h.DB.Delete(&rt)
+	// A reset usually means the account may be compromised: end every session
+	var user models.User
+	if h.DB.Select("id").Where("email = ?", rt.Email).First(&user).Error == nil {
+		revokeUserSessions(h.DB, user.ID)
+		// Proving control of the inbox also lifts any lockout and verifies the address
+		h.DB.Model(&user).UpdateColumns(map[string]interface{}{"failed_logins": 0, "locked_until": nil, "email_verified": true})
+		recordSecurityEvent(c, h.DB, user.ID, "auth.password_reset", nil)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
 }
@@ -41,27 +41,7 @@ func cleanupOldOrders(db *gorm.DB, hoursToKeep int) {
 
 	for _, order := range oldOrders {
 		// Delete files from disk
-		if order.LocalFilePath != "" {
-			if err := os.Remove(order.LocalFilePath); err != nil {
-				fmt.Printf("[CLEANUP] Failed to delete file %s: %v\n", order.LocalFilePath, err)
-			} else {
-				fmt.Printf("[CLEANUP] Deleted file: %s\n", order.LocalFilePath)
-			}
-		}
-
-		if order.Report1Path != "" {
-			reportPath := filepath.Join("uploads", order.Report1Path)
-			if err := os.Remove(reportPath); err != nil {
-				fmt.Printf("[CLEANUP] Failed to delete report1 %s: %v\n", reportPath, err)
-			}
-		}
-
-		if order.Report2Path != "" {
-			reportPath := filepath.Join("uploads", order.Report2Path)
-			if err := os.Remove(reportPath); err != nil {
-				fmt.Printf("[CLEANUP] Failed to delete report2 %s: %v\n", reportPath, err)
-			}
-		}
+		removeOrderFiles(db, order)
 
 		// Delete from database
 		db.Delete(&order)
@@ -69,3 +49,33 @@ func cleanupOldOrders(db *gorm.DB, hoursToKeep int) {
 
 	fmt.Printf("[CLEANUP] Successfully deleted %d old orders\n", len(oldOrders))
 }
+
+// removeOrderFiles deletes an order's upload, report files and message attachments from disk.
+// Report rows are kept so scores stay on record after the files are gone.
+func removeOrderFiles(db *gorm.DB, order models.Order) {
+	if order.LocalFilePath != "" {
+		if err := os.Remove(order.LocalFilePath); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("[CLEANUP] Failed to delete file %s: %v\n", order.LocalFilePath, err)
+		} else {
+			fmt.Printf("[CLEANUP] Deleted file: %s\n", order.LocalFilePath)
+		}
+	}
+
+	var reports []models.Report
+	db.Where("order_id = ? AND file_path <> ''", order.ID).Find(&reports)
+	for _, report := range reports {
+		reportPath := filepath.Join("uploads", report.FilePath)
+		if err := os.Remove(reportPath); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("[CLEANUP] Failed to delete %s report %s: %v\n", report.Type, reportPath, err)
+		}
+	}
+
+	var messages []models.OrderMessage
+	db.Where("order_id = ? AND attachment_path <> ''", order.ID).Find(&messages)
+	for _, message := range messages {
+		attachmentPath := filepath.Join("uploads", message.AttachmentPath)
+		if err := os.Remove(attachmentPath); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("[CLEANUP] Failed to delete attachment %s: %v\n", attachmentPath, err)
+		}
+	}
+}
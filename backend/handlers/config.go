@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"os"
+	"strconv"
+)
+
+// envInt reads an integer setting from the environment, falling back when unset or invalid
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+// envBool reads a true/false setting from the environment
+func envBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// appURL is the public frontend address used in emails and certificates
+func appURL() string {
+	baseURL := os.Getenv("APP_URL")
+	if baseURL == "" {
+		baseURL = "https://checkmateturnit.icu"
+	}
+	return baseURL
+}
+
+// parsePositiveInt parses query values such as page sizes, rejecting zero and negatives
+func parsePositiveInt(value string) (int, bool) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// hashKey is the HMAC key for one kind of stored hash: envKey when set,
+// otherwise a key derived from JWT_SECRET for that purpose alone, so the
+// token signing key is never used as a hash key itself
+func hashKey(envKey, purpose string) []byte {
+	if key := os.Getenv(envKey); key != "" {
+		return []byte(key)
+	}
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWT_SECRET")))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
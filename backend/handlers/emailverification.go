@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// verificationCodeTTL is how long an emailed verification code works
+const verificationCodeTTL = 10 * time.Minute
+
+var errEmailInUse = errors.New("That email address is already in use")
+
+// verificationKey scopes a code to the account and the address it confirms,
+// so a code sent to one address can't confirm another
+func verificationKey(userID uint, email string) string {
+	return fmt.Sprintf("verify:%d:%s", userID, strings.ToLower(email))
+}
+
+// sendVerificationCode emails a code proving the user controls email. The
+// same code confirms a new account, re-verifies the current address, or
+// moves the account to a new one.
+func sendVerificationCode(db *gorm.DB, user models.User, email string) error {
+	code, err := issueOTP(db, verificationKey(user.ID, email), verificationCodeTTL)
+	if err != nil {
+		return err
+	}
+	subject := "Verify your Checkmate email"
+	if !strings.EqualFold(email, user.Email) {
+		subject = "Confirm your new Checkmate email"
+	}
+	return sendEmail(email, subject, fmt.Sprintf("Your verification code is: %s\n\nIt expires in %d minutes.", code, int(verificationCodeTTL.Minutes())))
+}
+
+// confirmVerificationCode checks a code from sendVerificationCode and marks
+// the address verified, switching the account to it if it is a new one
+func confirmVerificationCode(c *gin.Context, db *gorm.DB, user *models.User, email, code string) error {
+	if err := consumeOTP(db, verificationKey(user.ID, email), code); err != nil {
+		return err
+	}
+
+	before := gin.H{"email_hash": auditEmail(user.Email), "email_verified": user.EmailVerified}
+	oldEmail := user.Email
+	changed := email != user.Email
+	if err := db.Model(user).Updates(map[string]interface{}{"email": email, "email_verified": true}).Error; err != nil {
+		return errEmailInUse
+	}
+	user.Email, user.EmailVerified = email, true
+
+	if !changed {
+		recordAudit(c, db, "user.email_verify", "user", user.ID, gin.H{"email_hash": auditEmail(email)})
+	} else {
+		recordAuditChange(c, db, "user.email_change", "user", user.ID, before, gin.H{"email_hash": auditEmail(email), "email_verified": true}, nil)
+		// Sign-in links went to the old address, and anyone signed in
+		// elsewhere may be who the old address is being taken from
+		db.Where("user_id = ?", user.ID).Delete(&models.MagicLinkToken{})
+		sessionID, _ := c.Get("sessionID")
+		currentSession, _ := sessionID.(uint)
+		revokeOtherSessions(db, user.ID, currentSession)
+
+		// Let the old address know, in case this wasn't them
+		go func() {
+			if err := sendEmail(oldEmail, "Your Checkmate email was changed",
+				"The email address on your Checkmate account was changed to "+email+".\n\nIf you didn't do this, contact support immediately."); err != nil {
+				fmt.Println("SMTP Error:", err)
+			}
+		}()
+	}
+
+	if adminEmail := os.Getenv("ADMIN_EMAIL"); email == adminEmail {
+		PromoteAdminEmail(db, adminEmail)
+	}
+	return nil
+}
+
+// markEmailVerified records that the user proved control of their address
+// some other way, e.g. by following a password reset or sign-in link
+func markEmailVerified(db *gorm.DB, user *models.User) {
+	if user.EmailVerified {
+		return
+	}
+	db.Model(&models.User{}).Where("id = ?", user.ID).UpdateColumn("email_verified", true)
+	user.EmailVerified = true
+}
+
+// claimUnverifiedAccount hands an account whose address was never verified
+// to whoever has just proved they own it (through Google, single sign-on or
+// a magic link). Someone else may have signed up with the address first to
+// lie in wait, so the password, second factor, linked sign-ins and sessions
+// they could have set up are removed. Staff accounts are left alone.
+func claimUnverifiedAccount(c *gin.Context, db *gorm.DB, user *models.User) {
+	if user.EmailVerified {
+		return
+	}
+	var roles int64
+	db.Table("user_roles").Where("user_id = ?", user.ID).Count(&roles)
+	if roles > 0 {
+		return
+	}
+
+	db.Model(&models.User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{
+		"password_hash": "",
+		"totp_secret":   "",
+		"totp_enabled":  false,
+	})
+	db.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{})
+	db.Where("user_id = ?", user.ID).Delete(&models.UserIdentity{})
+	revokeUserSessions(db, user.ID)
+	user.PasswordHash, user.TOTPSecret, user.TOTPEnabled = "", "", false
+	recordSecurityEvent(c, db, user.ID, "user.account_claimed", nil)
+}
+
+// respondVerificationError maps confirmVerificationCode errors to responses
+func respondVerificationError(c *gin.Context, err error) {
+	if errors.Is(err, errEmailInUse) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// respondSendError maps sendVerificationCode errors to responses
+func respondSendError(c *gin.Context, err error) {
+	if errors.Is(err, errSMTPNotConfigured) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "SMTP credentials missing in env"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email: " + err.Error()})
+}
+
+// SendEmailVerification emails a code to confirm the current address
+func (h *ProfileHandler) SendEmailVerification(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusConflict, gin.H{"error": "Your email address is already verified"})
+		return
+	}
+	if err := sendVerificationCode(h.DB, user, user.Email); err != nil {
+		respondSendError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Verification code sent to " + user.Email})
+}
+
+// ConfirmEmailVerification marks the current address verified
+func (h *ProfileHandler) ConfirmEmailVerification(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Code string `json:"code"`
+	}
+	if c.BindJSON(&body) != nil || strings.TrimSpace(body.Code) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification code is required"})
+		return
+	}
+	if err := confirmVerificationCode(c, h.DB, &user, user.Email, body.Code); err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, profileResponse(user))
+}
+
+// MarkExistingUsersVerified runs before AutoMigrate adds the verified flag.
+// Accounts made until now proved their address with the signup code or
+// through their identity provider, so they start out verified.
+func MarkExistingUsersVerified(db *gorm.DB) {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.User{}) || migrator.HasColumn(&models.User{}, "email_verified") {
+		return
+	}
+	if err := migrator.AddColumn(&models.User{}, "EmailVerified"); err != nil {
+		log.Printf("Failed to add email_verified column: %v\n", err)
+		return
+	}
+	db.Unscoped().Model(&models.User{}).Where("1 = 1").UpdateColumn("email_verified", true)
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// providerGoogle is the UserIdentity.Provider for Sign in with Google
+const providerGoogle = "google"
+
+// addIdentity records that the user can sign in with provider/subject
+func addIdentity(db *gorm.DB, userID uint, provider, subject, email string) error {
+	now := time.Now()
+	return db.Create(&models.UserIdentity{
+		UserID:     userID,
+		Provider:   provider,
+		Subject:    subject,
+		Email:      email,
+		LastUsedAt: &now,
+	}).Error
+}
+
+// findIdentity looks up the identity for provider/subject and marks it used
+func findIdentity(db *gorm.DB, provider, subject, email string) (models.UserIdentity, bool) {
+	var identity models.UserIdentity
+	if err := db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return identity, false
+	}
+	db.Model(&identity).Updates(map[string]interface{}{"last_used_at": time.Now(), "email": email})
+	return identity, true
+}
+
+// ListIdentities returns the ways the user can sign in
+func (h *AuthHandler) ListIdentities(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uid := uint(userID.(float64))
+
+	var user models.User
+	if err := h.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	var identities []models.UserIdentity
+	h.DB.Where("user_id = ?", uid).Order("created_at asc").Find(&identities)
+
+	c.JSON(http.StatusOK, gin.H{
+		"has_password": user.PasswordHash != "",
+		"identities":   identities,
+	})
+}
+
+// LinkGoogle adds Google sign-in to the signed-in account. The session proves
+// the account and the fresh ID token proves the Google account.
+func (h *AuthHandler) LinkGoogle(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uid := uint(userID.(float64))
+
+	var body struct {
+		Credential string `json:"credential"`
+	}
+	if c.BindJSON(&body) != nil || body.Credential == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing credential"})
+		return
+	}
+	if h.google.clientID == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Google sign-in is not configured"})
+		return
+	}
+	claims, err := h.google.verify(body.Credential)
+	if err != nil {
+		fmt.Println("Google token rejected:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Google Token"})
+		return
+	}
+	subject := claimString(claims, "sub")
+
+	var existing models.UserIdentity
+	if h.DB.Where("provider = ? AND subject = ?", providerGoogle, subject).First(&existing).Error == nil {
+		if existing.UserID == uid {
+			c.JSON(http.StatusOK, gin.H{"message": "Google account already linked"})
+		} else {
+			c.JSON(http.StatusConflict, gin.H{"error": "This Google account is linked to another user"})
+		}
+		return
+	}
+	var count int64
+	h.DB.Model(&models.UserIdentity{}).Where("user_id = ? AND provider = ?", uid, providerGoogle).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Unlink your current Google account first"})
+		return
+	}
+
+	if err := addIdentity(h.DB, uid, providerGoogle, subject, claimString(claims, "email")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link Google account"})
+		return
+	}
+	recordAudit(c, h.DB, "user.identity_link", "user", uid, gin.H{"provider": providerGoogle, "email_hash": auditEmail(claimString(claims, "email"))})
+	c.JSON(http.StatusOK, gin.H{"message": "Google account linked"})
+}
+
+// SetPassword lets an account created through Google or single sign-on add a
+// password. Accounts that already have one use the password reset flow.
+func (h *AuthHandler) SetPassword(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uid := uint(userID.(float64))
+
+	var body struct {
+		Password string `json:"password"`
+	}
+	if c.BindJSON(&body) != nil || body.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is required"})
+		return
+	}
+	var user models.User
+	if err := h.DB.Select("id", "email").First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if rejectWeakPassword(c, body.Password, user.Email) {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), 10)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	// Only fills an empty hash, so this can't overwrite an existing password
+	result := h.DB.Model(&models.User{}).Where("id = ? AND (password_hash = '' OR password_hash IS NULL)", uid).
+		Update("password_hash", string(hash))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set password"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Your account already has a password"})
+		return
+	}
+	recordAudit(c, h.DB, "user.password_set", "user", uid, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Password added. You can now sign in with your email and password."})
+}
+
+// UnlinkIdentity removes an external sign-in method, as long as the account
+// keeps at least one other way in
+func (h *AuthHandler) UnlinkIdentity(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uid := uint(userID.(float64))
+
+	var identity models.UserIdentity
+	if err := h.DB.Where("id = ? AND user_id = ?", c.Param("id"), uid).First(&identity).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sign-in method not found"})
+		return
+	}
+
+	var user models.User
+	h.DB.First(&user, uid)
+	var count int64
+	h.DB.Model(&models.UserIdentity{}).Where("user_id = ?", uid).Count(&count)
+	if user.PasswordHash == "" && count <= 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Add a password or another sign-in method before removing this one"})
+		return
+	}
+
+	if err := h.DB.Delete(&identity).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink"})
+		return
+	}
+	recordAudit(c, h.DB, "user.identity_unlink", "user", uid, gin.H{"provider": identity.Provider, "email_hash": auditEmail(identity.Email)})
+	c.JSON(http.StatusOK, gin.H{"message": "Sign-in method removed"})
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://issuer.example"
+	testClientID = "checkmate-client"
+	testKeyID    = "test-key"
+)
+
+// newTestVerifier serves a JWKS holding a freshly generated RSA key and
+// returns a verifier pointed at it, with the key to sign tokens with
+func newTestVerifier(t *testing.T) (*idTokenVerifier, *rsa.PrivateKey, *int32) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": testKeyID,
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	return &idTokenVerifier{
+		issuers:  []string{testIssuer},
+		clientID: testClientID,
+		keys:     newJWKSCache(srv.URL),
+	}, key, &fetches
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":   testIssuer,
+		"aud":   testClientID,
+		"sub":   "12345",
+		"email": "user@example.com",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testKeyID
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestVerifyAcceptsValidToken(t *testing.T) {
+	v, key, _ := newTestVerifier(t)
+	claims, err := v.verify(signRS256(t, key, validClaims()))
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if claimString(claims, "sub") != "12345" {
+		t.Fatalf("sub = %q, want 12345", claimString(claims, "sub"))
+	}
+}
+
+func TestVerifyRejectsBadTokens(t *testing.T) {
+	v, key, _ := newTestVerifier(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(name string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	cases := map[string]func() string{
+		"wrong audience": func() string { return signRS256(t, key, with("aud", "someone-else")) },
+		"wrong issuer":   func() string { return signRS256(t, key, with("iss", "https://evil.example")) },
+		"expired":        func() string { return signRS256(t, key, with("exp", time.Now().Add(-time.Hour).Unix())) },
+		"missing expiry": func() string { return signRS256(t, key, with("exp", nil)) },
+		"other key":      func() string { return signRS256(t, otherKey, validClaims()) },
+		"HS256": func() string {
+			// The classic confusion attack: an HMAC token keyed with public key material
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+			token.Header["kid"] = testKeyID
+			raw, err := token.SignedString(key.N.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return raw
+		},
+		"RS512": func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS512, validClaims())
+			token.Header["kid"] = testKeyID
+			raw, err := token.SignedString(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return raw
+		},
+		"unsigned": func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims())
+			raw, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return raw
+		},
+	}
+	for name, build := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := v.verify(build()); err == nil {
+				t.Fatal("token was accepted")
+			}
+		})
+	}
+}
+
+func TestUnknownKeyRefreshIsThrottled(t *testing.T) {
+	v, key, fetches := newTestVerifier(t)
+	if _, err := v.verify(signRS256(t, key, validClaims())); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+		token.Header["kid"] = "rotated-away"
+		raw, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := v.verify(raw); err == nil {
+			t.Fatal("token with unknown key ID was accepted")
+		}
+	}
+	if n := atomic.LoadInt32(fetches); n != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", n)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// impersonationTTL is how long an impersonation token works
+func impersonationTTL() time.Duration {
+	return time.Duration(envInt("IMPERSONATION_TTL_MINUTES", 30)) * time.Minute
+}
+
+// AdminStartImpersonation issues a short-lived token for viewing the app as
+// a customer. It is read-only unless a superadmin asks for write access, has
+// no refresh token, and stops working if the staff member signs out.
+func (h *AuthHandler) AdminStartImpersonation(c *gin.Context) {
+	var body struct {
+		Reason string `json:"reason"`
+		Write  bool   `json:"write"`
+	}
+	if c.BindJSON(&body) != nil || strings.TrimSpace(body.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.Preload("Roles").First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	actorID, _ := c.Get("userID")
+	sessionID, _ := c.Get("sessionID")
+	if uint(actorID.(float64)) == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't impersonate yourself"})
+		return
+	}
+	if len(user.Roles) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Staff accounts can't be impersonated"})
+		return
+	}
+	if body.Write && !userCan(h.DB, actorID, models.PermAll) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only superadmins can impersonate with write access"})
+		return
+	}
+	if body.Write && user.SuspendedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Suspended accounts can only be viewed read-only"})
+		return
+	}
+
+	impersonation := models.Impersonation{
+		ActorID:   uint(actorID.(float64)),
+		UserID:    user.ID,
+		SessionID: sessionID.(uint),
+		Reason:    strings.TrimSpace(body.Reason),
+		ReadOnly:  !body.Write,
+		ExpiresAt: time.Now().Add(impersonationTTL()),
+	}
+	if err := h.DB.Create(&impersonation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		return
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   user.ID,
+		"sid":   impersonation.SessionID,
+		"email": user.Email,
+		"admin": false,
+		"imp":   impersonation.ID,
+		"ro":    impersonation.ReadOnly,
+		"exp":   impersonation.ExpiresAt.Unix(),
+	}).SignedString([]byte(os.Getenv("JWT_SECRET")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	recordAudit(c, h.DB, "user.impersonate", "user", user.ID, gin.H{
+		"impersonation_id": impersonation.ID,
+		"reason":           impersonation.Reason,
+		"read_only":        impersonation.ReadOnly,
+		"expires_at":       impersonation.ExpiresAt,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_in": int(impersonationTTL().Seconds()),
+		"user": gin.H{
+			"id":          user.ID,
+			"email":       user.Email,
+			"is_admin":    false,
+			"permissions": []string{},
+		},
+		"impersonation": impersonation,
+	})
+}
+
+// EndImpersonation retires the impersonation token making the request
+func (h *AuthHandler) EndImpersonation(c *gin.Context) {
+	id, ok := c.Get("impersonationID")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not impersonating"})
+		return
+	}
+
+	var impersonation models.Impersonation
+	if err := h.DB.First(&impersonation, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Impersonation not found"})
+		return
+	}
+	h.DB.Model(&impersonation).Update("ended_at", time.Now())
+	recordAudit(c, h.DB, "user.impersonate_end", "user", impersonation.UserID, gin.H{"impersonation_id": impersonation.ID})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation ended"})
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const magicLinkToken = "magic"
+
+// magicLinkTTL is how long an emailed sign-in link stays valid
+func magicLinkTTL() time.Duration {
+	return time.Duration(envInt("MAGIC_LINK_TTL_MINUTES", 15)) * time.Minute
+}
+
+// RequestMagicLink emails a one-time sign-in link. The response is the same
+// whether or not the address has an account.
+func (h *AuthHandler) RequestMagicLink(c *gin.Context) {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if c.BindJSON(&body) != nil || body.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email"})
+		return
+	}
+	sent := gin.H{"message": "If an account exists for that address, a sign-in link is on its way"}
+
+	var user models.User
+	if err := whereEmail(h.DB, body.Email).First(&user).Error; err != nil {
+		c.JSON(http.StatusOK, sent)
+		return
+	}
+
+	jti, err := randomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sign-in link"})
+		return
+	}
+	expiresAt := time.Now().Add(magicLinkTTL())
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": user.ID,
+		"typ": magicLinkToken,
+		"jti": jti,
+		"exp": expiresAt.Unix(),
+	}).SignedString([]byte(os.Getenv("JWT_SECRET")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sign-in link"})
+		return
+	}
+
+	// Only the newest link works
+	h.DB.Where("user_id = ?", user.ID).Delete(&models.MagicLinkToken{})
+	h.DB.Create(&models.MagicLinkToken{UserID: user.ID, JTIHash: hashToken(jti), ExpiresAt: expiresAt})
+
+	link := appURL() + "/magic-link?token=" + url.QueryEscape(token)
+	// Sent in the background: a delivery failure (or the time the mail server
+	// takes) must not tell the caller that the address has an account
+	go func() {
+		err := sendEmail(user.Email, "Your Checkmate sign-in link",
+			fmt.Sprintf("Click the link to sign in:\n\n%s\n\nThe link works once and expires in %d minutes. If you didn't ask for it, you can ignore this email.",
+				link, int(magicLinkTTL().Minutes())))
+		if err != nil {
+			fmt.Println("SMTP Error:", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, sent)
+}
+
+// MagicLinkLogin redeems a sign-in link and finishes the login like a
+// password would (tokens, or a two-factor challenge)
+func (h *AuthHandler) MagicLinkLogin(c *gin.Context) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	if c.BindJSON(&body) != nil || body.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		return
+	}
+	invalid := gin.H{"error": "This sign-in link is invalid, expired or already used"}
+
+	token, err := jwt.Parse(body.Token, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+	if err != nil || !token.Valid {
+		c.JSON(http.StatusBadRequest, invalid)
+		return
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != magicLinkToken {
+		c.JSON(http.StatusBadRequest, invalid)
+		return
+	}
+	sub, _ := claims["sub"].(float64)
+
+	// Only one request can delete the row, so a link works once
+	result := h.DB.Where("user_id = ? AND jti_hash = ? AND expires_at > ?", uint(sub), hashToken(claimString(claims, "jti")), time.Now()).
+		Delete(&models.MagicLinkToken{})
+	if result.Error != nil || result.RowsAffected != 1 {
+		c.JSON(http.StatusBadRequest, invalid)
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, uint(sub)).Error; err != nil {
+		c.JSON(http.StatusBadRequest, invalid)
+		return
+	}
+	if rejectIfLocked(c, &user) {
+		return
+	}
+	// The link was emailed to the account's address
+	claimUnverifiedAccount(c, h.DB, &user)
+	markEmailVerified(h.DB, &user)
+	completeLogin(c, h.DB, user)
+}
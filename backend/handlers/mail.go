@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+var errSMTPNotConfigured = errors.New("SMTP credentials missing in env")
+
+var errBadRecipient = errors.New("invalid email recipient")
+
+// sendEmail sends a plain-text email through the SMTP account configured in .env
+func sendEmail(to, subject, body string) error {
+	from := os.Getenv("SMTP_EMAIL")
+	password := os.Getenv("SMTP_PASSWORD")
+	host := os.Getenv("SMTP_HOST")
+	port := os.Getenv("SMTP_PORT")
+
+	if from == "" || password == "" {
+		return errSMTPNotConfigured
+	}
+
+	msg, err := buildMessage(from, to, subject, body)
+	if err != nil {
+		return err
+	}
+
+	auth := smtp.PlainAuth("", from, password, host)
+	return smtp.SendMail(host+":"+port, auth, from, []string{to}, msg)
+}
+
+// buildMessage assembles the headers and body. Subjects often carry
+// user-supplied text such as filenames, so line breaks are dropped and the
+// subject is encoded rather than written into the header raw.
+func buildMessage(from, to, subject, body string) ([]byte, error) {
+	if strings.ContainsAny(to, "\r\n") {
+		return nil, errBadRecipient
+	}
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+
+	msg := "From: " + from + "\n" +
+		"To: " + to + "\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\n" +
+		"MIME-Version: 1.0\n" +
+		"Content-Type: text/plain; charset=utf-8\n\n" +
+		body
+	return []byte(msg), nil
+}
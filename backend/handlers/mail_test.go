@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSubjectCannotInjectHeaders(t *testing.T) {
+	msg, err := buildMessage("from@example.com", "to@example.com", "New message about \"x.pdf\r\nBcc: victim@example.com\"", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := strings.SplitN(string(msg), "\n\n", 2)[0]
+	for _, line := range strings.Split(headers, "\n") {
+		if strings.HasPrefix(strings.ToLower(line), "bcc:") {
+			t.Fatalf("injected header in message:\n%s", msg)
+		}
+	}
+}
+
+func TestRecipientWithLineBreakIsRejected(t *testing.T) {
+	if _, err := buildMessage("from@example.com", "to@example.com\nBcc: victim@example.com", "Hello", "hi"); err == nil {
+		t.Fatal("recipient with a line break was accepted")
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type MessageHandler struct {
+	DB                  *gorm.DB
+	NotificationHandler *NotificationHandler
+}
+
+func NewMessageHandler(db *gorm.DB, notificationHandler *NotificationHandler) *MessageHandler {
+	return &MessageHandler{
+		DB:                  db,
+		NotificationHandler: notificationHandler,
+	}
+}
+
+// threadOrder loads the order for a thread, enforcing ownership for non-admin callers
+func (h *MessageHandler) threadOrder(c *gin.Context, asAdmin bool) (*models.Order, bool) {
+	var order models.Order
+	if err := h.DB.First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return nil, false
+	}
+
+	if !asAdmin {
+		userID, _ := c.Get("userID")
+		if order.UserID != uint(userID.(float64)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			return nil, false
+		}
+	}
+	return &order, true
+}
+
+// listThread returns the thread and marks the other side's messages as read
+func (h *MessageHandler) listThread(c *gin.Context, asAdmin bool) {
+	order, ok := h.threadOrder(c, asAdmin)
+	if !ok {
+		return
+	}
+
+	var messages []models.OrderMessage
+	h.DB.Where("order_id = ?", order.ID).Order("created_at asc").Find(&messages)
+
+	// Read receipts: whoever is reading marks the opposite side's messages
+	// (but not staff looking over a customer's shoulder)
+	if _, impersonating := c.Get("impersonationID"); !impersonating {
+		h.DB.Model(&models.OrderMessage{}).
+			Where("order_id = ? AND from_admin = ? AND read_at IS NULL", order.ID, !asAdmin).
+			Update("read_at", time.Now())
+	}
+
+	c.JSON(http.StatusOK, messages)
+}
+
+// postMessage stores a message (JSON or multipart with an optional "attachment")
+// and notifies the other side by push and email
+func (h *MessageHandler) postMessage(c *gin.Context, asAdmin bool) {
+	order, ok := h.threadOrder(c, asAdmin)
+	if !ok {
+		return
+	}
+	userID, _ := c.Get("userID")
+	senderID := uint(userID.(float64))
+
+	var body struct {
+		Body string `json:"body" form:"body"`
+	}
+	c.ShouldBind(&body)
+	body.Body = strings.TrimSpace(body.Body)
+
+	message := models.OrderMessage{
+		OrderID:   order.ID,
+		SenderID:  senderID,
+		FromAdmin: asAdmin,
+		Body:      body.Body,
+	}
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		if file, err := c.FormFile("attachment"); err == nil {
+			const maxSize = 10 * 1024 * 1024 // 10MB
+			if file.Size > maxSize {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Attachment too large"})
+				return
+			}
+			filename := fmt.Sprintf("msg_%d_%d_%s", order.ID, time.Now().Unix(), filepath.Base(file.Filename))
+			if err := c.SaveUploadedFile(file, filepath.Join("./uploads", filename)); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment"})
+				return
+			}
+			message.AttachmentPath = filename
+			message.AttachmentName = file.Filename
+		}
+	}
+
+	if message.Body == "" && message.AttachmentPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message cannot be empty"})
+		return
+	}
+
+	if err := h.DB.Create(&message).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		return
+	}
+	if asAdmin {
+		recordAudit(c, h.DB, "order.message", "order", order.ID, gin.H{"message_id": message.ID, "attachment": message.AttachmentName})
+	}
+
+	go h.notify(*order, message)
+
+	c.JSON(http.StatusOK, message)
+}
+
+// notify tells the other side of the thread about a new message
+func (h *MessageHandler) notify(order models.Order, message models.OrderMessage) {
+	preview := message.Body
+	if runes := []rune(preview); len(runes) > 120 {
+		preview = string(runes[:120]) + "..."
+	}
+	if preview == "" {
+		preview = "Sent an attachment: " + message.AttachmentName
+	}
+
+	if !message.FromAdmin {
+		if h.NotificationHandler != nil {
+			h.NotificationHandler.SendToAdmins(
+				"💬 New Message",
+				fmt.Sprintf("Order #%d \"%s\": %s", order.ID, order.OriginalFilename, preview),
+				"/dashboard/admin/orders",
+			)
+		}
+		return
+	}
+
+	if h.NotificationHandler != nil {
+		h.NotificationHandler.SendToUser(order.UserID,
+			"💬 Message about your document",
+			preview,
+			"/dashboard",
+		)
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, order.UserID).Error; err != nil {
+		return
+	}
+	err := sendEmail(user.Email, "New message about \""+order.OriginalFilename+"\"",
+		"Our team sent you a message about your document \""+order.OriginalFilename+"\":\n\n"+
+			preview+"\n\nReply from your dashboard: "+appURL()+"/dashboard")
+	if err != nil {
+		fmt.Println("Failed to email message notification:", err)
+	}
+}
+
+// unreadCounts returns unread messages from the other side, per order
+func (h *MessageHandler) unreadCounts(c *gin.Context, asAdmin bool) {
+	var rows []struct {
+		OrderID uint `json:"order_id"`
+		Count   int  `json:"count"`
+	}
+
+	query := h.DB.Model(&models.OrderMessage{}).
+		Select("order_messages.order_id, COUNT(*) AS count").
+		Joins("JOIN orders ON orders.id = order_messages.order_id AND orders.deleted_at IS NULL").
+		Where("order_messages.from_admin = ? AND order_messages.read_at IS NULL", !asAdmin)
+	if !asAdmin {
+		userID, _ := c.Get("userID")
+		query = query.Where("orders.user_id = ?", userID)
+	}
+	query.Group("order_messages.order_id").Scan(&rows)
+
+	total := 0
+	for _, row := range rows {
+		total += row.Count
+	}
+	c.JSON(http.StatusOK, gin.H{"total": total, "orders": rows})
+}
+
+// ListMessages returns the thread for one of the user's orders
+func (h *MessageHandler) ListMessages(c *gin.Context) { h.listThread(c, false) }
+
+// PostMessage sends a message from the user to the admins
+func (h *MessageHandler) PostMessage(c *gin.Context) { h.postMessage(c, false) }
+
+// UnreadMessages counts admin replies the user hasn't read yet
+func (h *MessageHandler) UnreadMessages(c *gin.Context) { h.unreadCounts(c, false) }
+
+// AdminListMessages returns the thread for any order (Admin only)
+func (h *MessageHandler) AdminListMessages(c *gin.Context) { h.listThread(c, true) }
+
+// AdminPostMessage sends a message from an admin to the order's owner
+func (h *MessageHandler) AdminPostMessage(c *gin.Context) { h.postMessage(c, true) }
+
+// AdminUnreadMessages counts user messages no admin has read yet
+func (h *MessageHandler) AdminUnreadMessages(c *gin.Context) { h.unreadCounts(c, true) }
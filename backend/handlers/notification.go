@@ -139,21 +139,23 @@ func (h *NotificationHandler) Unsubscribe(c *gin.Context) {
 
 // Send notification to all admin subscriptions
 func (h *NotificationHandler) SendToAdmins(title, body, url string) {
-	// Get all admin users
+	// Get all staff who receive alerts
 	var admins []models.User
-	if err := h.db.Where("is_admin = ?", true).Find(&admins).Error; err != nil {
+	if err := h.db.Preload("Roles").Where("is_admin = ?", true).Find(&admins).Error; err != nil {
 		log.Println("Error fetching admins:", err)
 		return
 	}
 
-	if len(admins) == 0 {
-		return
-	}
-
 	// Get subscriptions for all admins
 	var adminIDs []uint
 	for _, admin := range admins {
-		adminIDs = append(adminIDs, admin.ID)
+		if admin.HasPermission(models.PermNotifications) {
+			adminIDs = append(adminIDs, admin.ID)
+		}
+	}
+
+	if len(adminIDs) == 0 {
+		return
 	}
 
 	var subscriptions []models.PushSubscription
@@ -168,6 +170,19 @@ func (h *NotificationHandler) SendToAdmins(title, body, url string) {
 	}
 }
 
+// Send notification to every device a user has subscribed
+func (h *NotificationHandler) SendToUser(userID uint, title, body, url string) {
+	var subscriptions []models.PushSubscription
+	if err := h.db.Where("user_id = ?", userID).Find(&subscriptions).Error; err != nil {
+		log.Println("Error fetching subscriptions:", err)
+		return
+	}
+
+	for _, sub := range subscriptions {
+		go h.sendNotification(sub, title, body, url)
+	}
+}
+
 // Send notification to a specific subscription
 func (h *NotificationHandler) sendNotification(sub models.PushSubscription, title, body, url string) {
 	// Create notification payload
@@ -0,0 +1,579 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// oidcProvider is one configured OpenID Connect identity provider (e.g. a
+// university's campus login). Endpoints come from its discovery document.
+type oidcProvider struct {
+	ID           string
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       string
+
+	// Claim mapping onto models.User
+	EmailClaim     string
+	FirstNameClaim string
+	LastNameClaim  string
+	// TrustEmail accepts the email claim even without email_verified
+	// (many campus IdPs only release addresses they issued themselves)
+	TrustEmail bool
+
+	mu           sync.Mutex
+	discovery    *oidcDiscovery
+	discoveredAt time.Time
+	verifier     *idTokenVerifier
+}
+
+// oidcDiscovery is the part of /.well-known/openid-configuration we use
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// loadOIDCProviders reads OIDC_PROVIDERS (comma-separated IDs) and each
+// provider's OIDC_<ID>_* settings
+func loadOIDCProviders() []*oidcProvider {
+	var providers []*oidcProvider
+	for _, id := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(id, "-", "_")) + "_"
+		setting := func(name, fallback string) string {
+			if value := os.Getenv(prefix + name); value != "" {
+				return value
+			}
+			return fallback
+		}
+
+		p := &oidcProvider{
+			ID:             id,
+			Name:           setting("NAME", id),
+			Issuer:         setting("ISSUER", ""),
+			ClientID:       setting("CLIENT_ID", ""),
+			ClientSecret:   setting("CLIENT_SECRET", ""),
+			Scopes:         setting("SCOPES", "openid email profile"),
+			EmailClaim:     setting("EMAIL_CLAIM", "email"),
+			FirstNameClaim: setting("FIRST_NAME_CLAIM", "given_name"),
+			LastNameClaim:  setting("LAST_NAME_CLAIM", "family_name"),
+			TrustEmail:     envBool(prefix+"TRUST_EMAIL", false),
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			log.Printf("OIDC provider %q is missing %sISSUER or %sCLIENT_ID: skipped\n", id, prefix, prefix)
+			continue
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
+
+// discover fetches (and caches for a day) the provider's discovery document
+func (p *oidcProvider) discover() (*oidcDiscovery, *idTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil && time.Since(p.discoveredAt) < 24*time.Hour {
+		return p.discovery, p.verifier, nil
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("discovery returned %d", resp.StatusCode)
+	}
+
+	var doc oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return nil, nil, fmt.Errorf("discovery issuer %q does not match %q", doc.Issuer, p.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, nil, errors.New("discovery document is missing endpoints")
+	}
+
+	// Keep the key cache across refreshes unless the JWKS location moved
+	if p.verifier == nil || p.discovery.JWKSURI != doc.JWKSURI {
+		p.verifier = &idTokenVerifier{clientID: p.ClientID, keys: newJWKSCache(doc.JWKSURI)}
+	}
+	p.verifier.issuers = []string{doc.Issuer}
+	p.discovery = &doc
+	p.discoveredAt = time.Now()
+	return p.discovery, p.verifier, nil
+}
+
+// identityProvider is the UserIdentity.Provider value for this IdP
+func (p *oidcProvider) identityProvider() string {
+	return "oidc:" + p.ID
+}
+
+type OIDCHandler struct {
+	DB        *gorm.DB
+	providers []*oidcProvider
+}
+
+func NewOIDCHandler(db *gorm.DB) *OIDCHandler {
+	return &OIDCHandler{DB: db, providers: loadOIDCProviders()}
+}
+
+func (h *OIDCHandler) provider(id string) *oidcProvider {
+	for _, p := range h.providers {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// oidcCallbackURL is the redirect_uri registered with every provider
+func oidcCallbackURL(providerID string) string {
+	base := os.Getenv("OIDC_CALLBACK_BASE_URL")
+	if base == "" {
+		base = appURL()
+	}
+	return strings.TrimSuffix(base, "/") + "/auth/oidc/" + providerID + "/callback"
+}
+
+// ListProviders returns the configured identity providers for the login page
+func (h *OIDCHandler) ListProviders(c *gin.Context) {
+	providers := []gin.H{}
+	for _, p := range h.providers {
+		providers = append(providers, gin.H{"id": p.ID, "name": p.Name})
+	}
+	c.JSON(http.StatusOK, providers)
+}
+
+// Start redirects the browser to the provider's login page (authorization
+// code flow with PKCE, state and nonce)
+func (h *OIDCHandler) Start(c *gin.Context) {
+	p := h.provider(c.Param("provider"))
+	if p == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown sign-in provider"})
+		return
+	}
+	authURL, ok := h.beginLogin(c, p, 0)
+	if !ok {
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// StartLink begins the same flow for a signed-in user, whose account the
+// provider is linked to on return. The frontend navigates to the URL.
+func (h *OIDCHandler) StartLink(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uid := uint(userID.(float64))
+
+	p := h.provider(c.Param("provider"))
+	if p == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown sign-in provider"})
+		return
+	}
+	authURL, ok := h.beginLogin(c, p, uid)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": authURL})
+}
+
+// oidcBrowserCookie ties a pending login to the browser that started it
+const oidcBrowserCookie = "oidc_browser"
+
+// setBrowserBinding sets (or with maxAge -1 clears) the browser binding
+// cookie. It is only sent to the callback, including on the top-level
+// redirect back from the provider, which SameSite=Lax allows.
+func setBrowserBinding(c *gin.Context, p *oidcProvider, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcBrowserCookie, value, maxAge, "/auth/oidc", "", strings.HasPrefix(oidcCallbackURL(p.ID), "https://"), true)
+}
+
+// beginLogin records a pending login and returns the provider URL to send
+// the browser to. It answers the request itself on failure.
+func (h *OIDCHandler) beginLogin(c *gin.Context, p *oidcProvider, linkUserID uint) (string, bool) {
+	doc, _, err := p.discover()
+	if err != nil {
+		log.Printf("OIDC discovery failed for %s: %v\n", p.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Sign-in provider is unavailable"})
+		return "", false
+	}
+
+	state, errState := randomToken(32)
+	nonce, errNonce := randomToken(16)
+	verifier, errVerifier := randomToken(32)
+	binding, errBinding := randomToken(32)
+	if errState != nil || errNonce != nil || errVerifier != nil || errBinding != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return "", false
+	}
+
+	// Drop abandoned attempts
+	h.DB.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLogin{})
+
+	login := models.OIDCLogin{
+		Provider:     p.ID,
+		StateHash:    hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		BrowserHash:  hashToken(binding),
+		ExpiresAt:    time.Now().Add(10 * time.Minute),
+	}
+	if err := h.DB.Create(&login).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return "", false
+	}
+
+	// Only the browser that began the flow can finish it, so nobody can send
+	// someone else a provider URL and have their sign-in land in a session
+	// (or on an account) of the sender's choosing
+	setBrowserBinding(c, p, binding, int((10 * time.Minute).Seconds()))
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {oidcCallbackURL(p.ID)},
+		"scope":                 {p.Scopes},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return doc.AuthorizationEndpoint + separator + query.Encode(), true
+}
+
+// Callback receives the browser back from the provider, verifies the login
+// and hands the frontend a single-use ticket in the URL fragment. A linking
+// flow instead adds the identity and returns to the account page.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	page := "/login"
+	fail := func(message string) {
+		c.Redirect(http.StatusFound, appURL()+page+"#sso_error="+url.QueryEscape(message))
+	}
+
+	p := h.provider(c.Param("provider"))
+	if p == nil {
+		fail("Unknown sign-in provider")
+		return
+	}
+	if idpError := c.Query("error"); idpError != "" {
+		log.Printf("OIDC %s returned error %s: %s\n", p.ID, idpError, c.Query("error_description"))
+		fail("Sign-in was cancelled or denied")
+		return
+	}
+
+	var login models.OIDCLogin
+	err := h.DB.Where("state_hash = ? AND provider = ? AND user_id = 0 AND expires_at > ?",
+		hashToken(c.Query("state")), p.ID, time.Now()).First(&login).Error
+	if err != nil {
+		fail("Sign-in session expired. Please try again.")
+		return
+	}
+	if login.LinkUserID != 0 {
+		page = "/account"
+	}
+	binding, _ := c.Cookie(oidcBrowserCookie)
+	setBrowserBinding(c, p, "", -1)
+	if binding == "" || subtle.ConstantTimeCompare([]byte(hashToken(binding)), []byte(login.BrowserHash)) != 1 {
+		fail("Sign-in must be finished in the browser it was started from. Please try again.")
+		return
+	}
+
+	claims, err := h.exchangeCode(p, c.Query("code"), login)
+	if err != nil {
+		log.Printf("OIDC %s login rejected: %v\n", p.ID, err)
+		fail("Could not verify your sign-in")
+		return
+	}
+
+	if login.LinkUserID != 0 {
+		// Deleting the row makes the callback single-use
+		if result := h.DB.Where("id = ? AND user_id = 0", login.ID).Delete(&models.OIDCLogin{}); result.Error != nil || result.RowsAffected != 1 {
+			fail("Sign-in session expired. Please try again.")
+			return
+		}
+		if err := h.linkIdentity(c, p, login.LinkUserID, claims); err != nil {
+			fail(err.Error())
+			return
+		}
+		c.Redirect(http.StatusFound, appURL()+page+"#sso_linked="+url.QueryEscape(p.Name))
+		return
+	}
+
+	user, err := h.findOrCreateUser(c, p, claims)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	ticket, err := randomToken(32)
+	if err != nil {
+		fail("Failed to complete sign-in")
+		return
+	}
+	// Claiming the row with user_id = 0 makes the callback single-use
+	result := h.DB.Model(&models.OIDCLogin{}).Where("id = ? AND user_id = 0", login.ID).
+		Updates(map[string]interface{}{
+			"user_id":     user.ID,
+			"ticket_hash": hashToken(ticket),
+			"expires_at":  time.Now().Add(2 * time.Minute),
+		})
+	if result.Error != nil || result.RowsAffected != 1 {
+		fail("Sign-in session expired. Please try again.")
+		return
+	}
+
+	c.Redirect(http.StatusFound, appURL()+"/login#sso_ticket="+ticket)
+}
+
+// exchangeCode redeems the authorization code and returns the verified ID
+// token claims, merged with the userinfo endpoint when available
+func (h *OIDCHandler) exchangeCode(p *oidcProvider, code string, login models.OIDCLogin) (jwt.MapClaims, error) {
+	if code == "" {
+		return nil, errors.New("missing authorization code")
+	}
+	doc, verifier, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oidcCallbackURL(p.ID)},
+		"code_verifier": {login.CodeVerifier},
+	}
+	if p.ClientSecret == "" {
+		// Public client: PKCE alone proves we started the flow
+		form.Set("client_id", p.ClientID)
+	}
+	req, err := http.NewRequest("POST", doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken     string `json:"id_token"`
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK || tokens.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint returned %d %s", resp.StatusCode, tokens.Error)
+	}
+
+	claims, err := verifier.verify(tokens.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if claimString(claims, "nonce") != login.Nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+	if claimString(claims, "sub") == "" {
+		return nil, errors.New("missing subject")
+	}
+
+	// Some IdPs only put profile claims in userinfo
+	if claimString(claims, p.EmailClaim) == "" && doc.UserinfoEndpoint != "" && tokens.AccessToken != "" {
+		mergeUserinfo(client, doc.UserinfoEndpoint, tokens.AccessToken, claims)
+	}
+	return claims, nil
+}
+
+// mergeUserinfo adds userinfo claims the ID token lacks, provided they are
+// about the same subject
+func mergeUserinfo(client *http.Client, endpoint, accessToken string, claims jwt.MapClaims) {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	info := map[string]interface{}{}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&info) != nil {
+		return
+	}
+	if info["sub"] != claims["sub"] {
+		return
+	}
+	for name, value := range info {
+		if _, exists := claims[name]; !exists {
+			claims[name] = value
+		}
+	}
+}
+
+// findOrCreateUser maps the provider's claims to a user: a known subject
+// signs in to its linked account, otherwise a verified email creates a new
+// one. An existing account with that address has to link the provider after
+// signing in the usual way, unless it has no other way in at all (the same
+// rule as Google sign-in) or its address was never verified.
+func (h *OIDCHandler) findOrCreateUser(c *gin.Context, p *oidcProvider, claims jwt.MapClaims) (models.User, error) {
+	var user models.User
+	subject := claimString(claims, "sub")
+	email := strings.ToLower(strings.TrimSpace(claimString(claims, p.EmailClaim)))
+
+	if identity, ok := findIdentity(h.DB, p.identityProvider(), subject, email); ok {
+		if err := h.DB.First(&user, identity.UserID).Error; err != nil {
+			return user, errors.New("The linked account no longer exists")
+		}
+		return user, nil
+	}
+
+	if email == "" || !(p.TrustEmail || emailVerified(claims)) {
+		return user, errors.New("Your identity provider did not share a verified email address")
+	}
+
+	errLinkRequired := fmt.Errorf("An account with this email already exists. Sign in the way you usually do, then link %s from your account page.", p.Name)
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := whereEmail(tx.Preload("Roles"), email).First(&user).Error; err == nil {
+			// The provider has verified the address, which the account never did
+			claimUnverifiedAccount(c, tx, &user)
+
+			var linked int64
+			tx.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Count(&linked)
+			if user.PasswordHash != "" || linked > 0 || user.IsAdmin || len(user.Roles) > 0 {
+				return errLinkRequired
+			}
+		} else {
+			firstName, lastName := claimString(claims, p.FirstNameClaim), claimString(claims, p.LastNameClaim)
+			if firstName == "" && lastName == "" {
+				firstName, lastName, _ = strings.Cut(claimString(claims, "name"), " ")
+			}
+			user = models.User{
+				Email:         email,
+				FirstName:     firstName,
+				LastName:      lastName,
+				EmailVerified: true, // Vouched for by the provider
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		}
+		markEmailVerified(tx, &user)
+		return addIdentity(tx, user.ID, p.identityProvider(), subject, email)
+	})
+	if errors.Is(err, errLinkRequired) {
+		return user, err
+	}
+	if err != nil {
+		log.Printf("OIDC %s: failed to link %s: %v\n", p.ID, email, err)
+		return user, errors.New("Failed to create your account")
+	}
+	return user, nil
+}
+
+// linkIdentity adds the provider's subject to a signed-in user's account
+func (h *OIDCHandler) linkIdentity(c *gin.Context, p *oidcProvider, userID uint, claims jwt.MapClaims) error {
+	subject := claimString(claims, "sub")
+	email := strings.ToLower(strings.TrimSpace(claimString(claims, p.EmailClaim)))
+
+	var existing models.UserIdentity
+	if h.DB.Where("provider = ? AND subject = ?", p.identityProvider(), subject).First(&existing).Error == nil {
+		if existing.UserID == userID {
+			return nil
+		}
+		return fmt.Errorf("This %s account is linked to another user", p.Name)
+	}
+	var count int64
+	h.DB.Model(&models.UserIdentity{}).Where("user_id = ? AND provider = ?", userID, p.identityProvider()).Count(&count)
+	if count > 0 {
+		return fmt.Errorf("Unlink your current %s account first", p.Name)
+	}
+
+	if err := addIdentity(h.DB, userID, p.identityProvider(), subject, email); err != nil {
+		log.Printf("OIDC %s: failed to link user %d: %v\n", p.ID, userID, err)
+		return fmt.Errorf("Failed to link %s", p.Name)
+	}
+	recordSecurityEvent(c, h.DB, userID, "user.identity_link", gin.H{"provider": p.identityProvider(), "email_hash": auditEmail(email)})
+	return nil
+}
+
+// Exchange swaps the ticket from Callback for a normal login response
+// (tokens, or a two-factor challenge)
+func (h *OIDCHandler) Exchange(c *gin.Context) {
+	var body struct {
+		Ticket string `json:"ticket"`
+	}
+	if c.BindJSON(&body) != nil || body.Ticket == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ticket is required"})
+		return
+	}
+
+	var login models.OIDCLogin
+	err := h.DB.Where("ticket_hash = ? AND user_id <> 0 AND expires_at > ?", hashToken(body.Ticket), time.Now()).
+		First(&login).Error
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in link expired. Please try again."})
+		return
+	}
+	// Only one request can delete the row, so a ticket works once
+	result := h.DB.Where("id = ?", login.ID).Delete(&models.OIDCLogin{})
+	if result.Error != nil || result.RowsAffected != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in link expired. Please try again."})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, login.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if rejectIfLocked(c, &user) {
+		return
+	}
+	completeLogin(c, h.DB, user)
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"checkmate-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestOIDCHandler has one provider whose discovery is already cached, so
+// starting a login never leaves the process
+func newTestOIDCHandler(t *testing.T) (*OIDCHandler, *gin.Engine) {
+	t.Helper()
+	db := newTestDB(t)
+	p := &oidcProvider{ID: "campus", Name: "Campus", Issuer: testIssuer, ClientID: testClientID, Scopes: "openid email"}
+	p.discovery = &oidcDiscovery{
+		Issuer:                testIssuer,
+		AuthorizationEndpoint: testIssuer + "/authorize",
+		TokenEndpoint:         "http://127.0.0.1:1/token",
+		JWKSURI:               "http://127.0.0.1:1/jwks",
+	}
+	p.discoveredAt = time.Now()
+	h := &OIDCHandler{DB: db, providers: []*oidcProvider{p}}
+
+	r := gin.New()
+	r.GET("/auth/oidc/:provider/start", h.Start)
+	r.GET("/auth/oidc/:provider/callback", h.Callback)
+	return h, r
+}
+
+// startLogin begins a flow and returns its state and binding cookie
+func startLogin(t *testing.T, r *gin.Engine) (string, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/campus/start", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("start: status = %d", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcBrowserCookie {
+			if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+				t.Fatalf("binding cookie is not HttpOnly and SameSite=Lax: %+v", cookie)
+			}
+			return location.Query().Get("state"), cookie
+		}
+	}
+	t.Fatal("start did not set the browser binding cookie")
+	return "", nil
+}
+
+func callback(r *gin.Engine, state string, cookie *http.Cookie) string {
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/campus/callback?code=abc&state="+url.QueryEscape(state), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Header().Get("Location")
+}
+
+func TestOIDCCallbackNeedsTheStartingBrowser(t *testing.T) {
+	h, r := newTestOIDCHandler(t)
+	state, cookie := startLogin(t, r)
+
+	// A victim who opens the attacker's provider URL has no (or another) binding
+	for name, c := range map[string]*http.Cookie{
+		"no cookie":    nil,
+		"other cookie": {Name: oidcBrowserCookie, Value: "someone-elses-flow"},
+	} {
+		if location := callback(r, state, c); !strings.Contains(location, "sso_error=Sign-in+must+be+finished") {
+			t.Fatalf("%s: callback was not refused, redirected to %s", name, location)
+		}
+	}
+
+	// The starting browser gets past the binding check to the code exchange
+	// (which fails here as there is no provider to redeem the code with)
+	if location := callback(r, state, cookie); !strings.Contains(location, "sso_error=Could+not+verify") {
+		t.Fatalf("binding check refused the starting browser: %s", location)
+	}
+
+	var claimed int64
+	h.DB.Model(&models.OIDCLogin{}).Where("user_id <> 0").Count(&claimed)
+	if claimed != 0 {
+		t.Fatal("a refused callback claimed the login")
+	}
+}
+
+func TestSignupMatchesEmailsIgnoringCase(t *testing.T) {
+	db := newTestDB(t)
+	db.Create(&models.User{Email: "someone@example.com"})
+
+	r := gin.New()
+	r.POST("/signup", NewAuthHandler(db).Signup)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/signup", bytes.NewBufferString(`{"email":"Someone@Example.com","password":"a long enough passphrase 42"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409 for the same address in another case", w.Code)
+	}
+}
@@ -2,8 +2,8 @@ package handlers
 
 import (
 	"checkmate-backend/models"
+	"errors"
 	"fmt"
-	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -26,18 +26,60 @@ func NewOrderHandler(db *gorm.DB, notificationHandler *NotificationHandler) *Ord
 	}
 }
 
+// queueOrder is the processing order for pending work: express first, then FIFO
+const queueOrder = "priority desc, created_at asc"
+
+// expressSurchargeSlots is the number of extra slots charged for an express upload
+func expressSurchargeSlots() int {
+	return envInt("EXPRESS_SURCHARGE_SLOTS", 1)
+}
+
+// turnaroundFor returns the promised turnaround for a priority tier
+func turnaroundFor(priority models.OrderPriority) time.Duration {
+	if priority == models.PriorityExpress {
+		return time.Duration(envInt("EXPRESS_TURNAROUND_MINUTES", 60)) * time.Minute
+	}
+	return time.Duration(envInt("STANDARD_TURNAROUND_MINUTES", 240)) * time.Minute
+}
+
 // Upload a file
 func (h *OrderHandler) Upload(c *gin.Context) {
 	userID, _ := c.Get("userID")
 	userIDUint := uint(userID.(float64))
 
-	// Check 2: User slots (personal credits)
-	hasSlots, userSlots := CheckUserSlots(h.DB, userIDUint)
-	if !hasSlots {
+	// Check 1: Re-check of an earlier version (may be discounted)
+	cost := 1
+	version := 1
+	var previousOrderID *uint
+	if prevID := c.PostForm("previous_order_id"); prevID != "" {
+		previous, err := findPreviousVersion(h.DB, prevID, userIDUint)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		cost, err = recheckCost(h.DB, previous)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		previousOrderID = &previous.ID
+		version = previous.Version + 1
+	}
+
+	// Check 2: Priority tier (express costs extra slots)
+	priority := models.PriorityStandard
+	if c.PostForm("express") == "true" {
+		priority = models.PriorityExpress
+		cost += expressSurchargeSlots()
+	}
+
+	// Check 3: User slots (personal credits)
+	_, userSlots := CheckUserSlots(h.DB, userIDUint)
+	if userSlots < cost {
 		c.JSON(http.StatusForbidden, gin.H{
 			"error":   "Insufficient upload slots",
-			"message": "You have 0 upload slots. Please purchase slots to continue.",
-			"slots":   0,
+			"message": fmt.Sprintf("You have %d upload slots but this upload needs %d. Please purchase slots to continue.", userSlots, cost),
+			"slots":   userSlots,
 		})
 		return
 	}
@@ -68,25 +110,54 @@ func (h *OrderHandler) Upload(c *gin.Context) {
 	}
 
 	// Create order record
+	dueAt := time.Now().Add(turnaroundFor(priority))
 	order := models.Order{
 		UserID:           userIDUint,
 		PaymentRef:       "SLOT_UPLOAD",
 		Status:           models.StatusPending,
 		OriginalFilename: file.Filename,
 		LocalFilePath:    dst,
+		WordCount:        countWords(dst),
+		PreviousOrderID:  previousOrderID,
+		Version:          version,
+		Priority:         priority,
+		DueAt:            &dueAt,
 	}
 
-	h.DB.Create(&order)
-
-	// Decrement counters
-	DecrementUserSlots(h.DB, userIDUint)
+	// Charge and record together: if another upload spent the slots since
+	// the check above, the order is rolled back
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		return DecrementUserSlotsBy(tx, userIDUint, cost)
+	})
+	if err != nil {
+		os.Remove(dst)
+		if errors.Is(err, errInsufficientSlots) {
+			_, userSlots = CheckUserSlots(h.DB, userIDUint)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Insufficient upload slots",
+				"message": fmt.Sprintf("You have %d upload slots but this upload needs %d. Please purchase slots to continue.", userSlots, cost),
+				"slots":   userSlots,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		return
+	}
+	_, userSlots = CheckUserSlots(h.DB, userIDUint)
 
 	// Send notification to admins
 	if h.NotificationHandler != nil {
 		var user models.User
 		h.DB.First(&user, userIDUint)
+		title := "📄 New Document Uploaded"
+		if priority == models.PriorityExpress {
+			title = "⚡ New Express Document Uploaded"
+		}
 		go h.NotificationHandler.SendToAdmins(
-			"📄 New Document Uploaded",
+			title,
 			fmt.Sprintf("%s %s uploaded \"%s\"", user.FirstName, user.LastName, file.Filename),
 			"/dashboard/admin/orders",
 		)
@@ -95,7 +166,8 @@ func (h *OrderHandler) Upload(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message":         "File uploaded successfully",
 		"order":           order,
-		"slots_remaining": userSlots - 1,
+		"slots_charged":   cost,
+		"slots_remaining": userSlots,
 	})
 }
 
@@ -103,11 +175,11 @@ func (h *OrderHandler) Upload(c *gin.Context) {
 func (h *OrderHandler) ListOrders(c *gin.Context) {
 	userID, _ := c.Get("userID")
 	var orders []models.Order
-	h.DB.Where("user_id = ?", userID).Order("created_at desc").Find(&orders)
+	h.DB.Preload("Reports").Where("user_id = ?", userID).Order("created_at desc").Find(&orders)
 
 	// Get all pending orders globally to calculate queue position
 	var pendingOrders []models.Order
-	h.DB.Where("status = ?", models.StatusPending).Order("created_at asc").Find(&pendingOrders)
+	h.DB.Where("status = ?", models.StatusPending).Order(queueOrder).Find(&pendingOrders)
 
 	// Create a map of order ID to queue position
 	queuePositions := make(map[uint]int)
@@ -132,17 +204,71 @@ func (h *OrderHandler) ListOrders(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// AdminListOrders returns all orders (Admin only)
+// AdminListOrders returns all orders (Admin only), express orders first.
+// Optional ?assigned=mine|unassigned narrows the list for multi-operator setups.
 func (h *OrderHandler) AdminListOrders(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	adminID := uint(userID.(float64))
+
+	query := h.DB.Preload("User").Preload("Assignee").Preload("Reports")
+	switch c.Query("assigned") {
+	case "mine":
+		query = query.Where("assigned_to = ? AND claim_expires_at >= ?", adminID, time.Now())
+	case "unassigned":
+		query = query.Where("assigned_to IS NULL OR claim_expires_at < ?", time.Now())
+	}
+
 	var orders []models.Order
 	// Eager load user data to avoid N+1 queries
-	h.DB.Preload("User").Order("created_at desc").Find(&orders)
+	query.Order("priority desc, created_at desc").Find(&orders)
 	c.JSON(http.StatusOK, orders)
 }
 
+// AdminSLAStats reports how many orders met their promised turnaround, per tier
+func (h *OrderHandler) AdminSLAStats(c *gin.Context) {
+	type tierStats struct {
+		Priority       models.OrderPriority `json:"priority"`
+		Completed      int64                `json:"completed"`
+		Met            int64                `json:"met"`
+		Missed         int64                `json:"missed"`
+		OverdueOpen    int64                `json:"overdue_open"`
+		TurnaroundMins int                  `json:"turnaround_minutes"`
+	}
+
+	now := time.Now()
+	stats := []tierStats{}
+	for _, priority := range []models.OrderPriority{models.PriorityExpress, models.PriorityStandard} {
+		s := tierStats{Priority: priority, TurnaroundMins: int(turnaroundFor(priority).Minutes())}
+		scope := h.DB.Model(&models.Order{}).Where("priority = ?", priority)
+		scope.Session(&gorm.Session{}).Where("status = ?", models.StatusCompleted).Count(&s.Completed)
+		scope.Session(&gorm.Session{}).Where("sla_met = ?", true).Count(&s.Met)
+		scope.Session(&gorm.Session{}).Where("sla_met = ?", false).Count(&s.Missed)
+		scope.Session(&gorm.Session{}).Where("status <> ? AND due_at < ?", models.StatusCompleted, now).Count(&s.OverdueOpen)
+		stats = append(stats, s)
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// orderAuditState is the part of an order staff actions change, for the audit log
+func orderAuditState(order models.Order) gin.H {
+	return gin.H{
+		"status":            order.Status,
+		"assigned_to":       order.AssignedTo,
+		"worker_id":         order.WorkerID,
+		"completed_by":      order.CompletedBy,
+		"completed_at":      order.CompletedAt,
+		"ai_score":          order.AIScore,
+		"sim_score":         order.SimScore,
+		"verification_code": order.VerificationCode,
+	}
+}
+
 // AdminComplete uploads results and updates status
 func (h *OrderHandler) AdminComplete(c *gin.Context) {
 	id := c.Param("id")
+	userID, _ := c.Get("userID")
+	adminID := uint(userID.(float64))
 
 	// Check if order exists
 	var order models.Order
@@ -151,48 +277,28 @@ func (h *OrderHandler) AdminComplete(c *gin.Context) {
 		return
 	}
 
-	// Handle Report Uploads
-	report1, _ := c.FormFile("report1")
-	report2, _ := c.FormFile("report2")
-
-	saveReport := func(fileHeader *multipart.FileHeader) string {
-		if fileHeader == nil {
-			return ""
-		}
-		timestamp := time.Now().Unix()
-		filename := fmt.Sprintf("report_%s_%d_%s", id, timestamp, fileHeader.Filename)
-		dst := filepath.Join("./uploads", filename)
-		if err := c.SaveUploadedFile(fileHeader, dst); err != nil {
-			return ""
-		}
-		return filename
-	}
-
-	if r1Path := saveReport(report1); r1Path != "" {
-		order.Report1Path = r1Path
-	}
-	if r2Path := saveReport(report2); r2Path != "" {
-		order.Report2Path = r2Path
+	// Another operator is actively working on this one
+	if heldByOther(order, adminID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order is claimed by another admin"})
+		return
 	}
 
-	// Update Scores
-	var body struct {
-		AIScore  int `form:"ai_score"`
-		SimScore int `form:"sim_score"`
+	before := orderAuditState(order)
+	order.CompletedBy = &adminID
+	if err := applyCompletion(c, h.DB, &order, fmt.Sprintf("admin:%d", adminID)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	c.Bind(&body)
+	recordAuditChange(c, h.DB, "order.complete", "order", order.ID, before, orderAuditState(order), nil)
 
-	order.Status = models.StatusCompleted
-	order.AIScore = body.AIScore
-	order.SimScore = body.SimScore
-
-	h.DB.Save(&order)
 	c.JSON(http.StatusOK, gin.H{"message": "Order completed", "order": order})
 }
 
-// AdminStartProcessing marks an order as being processed
+// AdminStartProcessing claims an order for the calling admin and marks it as being processed
 func (h *OrderHandler) AdminStartProcessing(c *gin.Context) {
 	id := c.Param("id")
+	userID, _ := c.Get("userID")
+	adminID := uint(userID.(float64))
 
 	var order models.Order
 	if err := h.DB.First(&order, id).Error; err != nil {
@@ -205,8 +311,21 @@ func (h *OrderHandler) AdminStartProcessing(c *gin.Context) {
 		return
 	}
 
-	order.Status = models.StatusProcessing
-	h.DB.Save(&order)
+	// Claim first so two admins can never start the same order
+	claimed, err := claimOrder(h.DB, order.ID, adminID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim order"})
+		return
+	}
+	if !claimed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order is claimed by another admin"})
+		return
+	}
+
+	before := orderAuditState(order)
+	h.DB.Model(&order).Update("status", models.StatusProcessing)
+	h.DB.Preload("Assignee").First(&order, order.ID)
+	recordAuditChange(c, h.DB, "order.start_processing", "order", order.ID, before, orderAuditState(order), nil)
 	c.JSON(http.StatusOK, gin.H{"message": "Order marked as processing", "order": order})
 }
 
@@ -243,13 +362,12 @@ func (h *OrderHandler) Download(c *gin.Context) {
 	// SECURITY: Check if user owns a file with this name in their orders
 	baseName := filepath.Base(actualPath)
 
-	// Bypass check if user is admin
-	isAdmin, _ := c.Get("isAdmin")
-	if isAdmin != true {
+	// Bypass check for staff who can view every order
+	if !userCan(h.DB, userID, models.PermOrdersView) {
 		var count int64
 		h.DB.Model(&models.Order{}).Where(
-			"user_id = ? AND (local_file_path LIKE ? OR report1_path LIKE ? OR report2_path LIKE ?)",
-			userID, "%"+baseName, "%"+baseName, "%"+baseName,
+			"user_id = ? AND (local_file_path LIKE ? OR EXISTS (SELECT 1 FROM reports WHERE reports.order_id = orders.id AND reports.file_path = ?) OR EXISTS (SELECT 1 FROM order_messages WHERE order_messages.order_id = orders.id AND order_messages.attachment_path = ?))",
+			userID, "%"+baseName, baseName, baseName,
 		).Count(&count)
 
 		if count == 0 {
@@ -260,9 +378,11 @@ func (h *OrderHandler) Download(c *gin.Context) {
 	}
 
 	// Extract original filename from the stored filename
-	// Pattern: userID_timestamp_originalFilename OR report_orderID_timestamp_originalFilename
-	parts := strings.SplitN(baseName, "_", 3)
-	if len(parts) == 3 {
+	// Pattern: userID_timestamp_originalFilename OR report|msg_orderID_timestamp_originalFilename
+	parts := strings.SplitN(baseName, "_", 4)
+	if (parts[0] == "report" || parts[0] == "msg") && len(parts) == 4 {
+		originalFilename = parts[3]
+	} else if parts = strings.SplitN(baseName, "_", 3); len(parts) == 3 {
 		originalFilename = parts[2]
 	}
 
@@ -296,15 +416,7 @@ func (h *OrderHandler) DeleteOrder(c *gin.Context) {
 	}
 
 	// Delete associated files from disk
-	if order.LocalFilePath != "" {
-		os.Remove(order.LocalFilePath)
-	}
-	if order.Report1Path != "" {
-		os.Remove(filepath.Join("uploads", order.Report1Path))
-	}
-	if order.Report2Path != "" {
-		os.Remove(filepath.Join("uploads", order.Report2Path))
-	}
+	removeOrderFiles(h.DB, order)
 
 	// Delete the order from database
 	h.DB.Delete(&order)
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"checkmate-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inTempDir runs the test from an empty directory with an uploads folder
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Mkdir("uploads", 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func uploadRequest(t *testing.T, filename string, express bool) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("some words to check"))
+	if express {
+		form.WriteField("express", "true")
+	}
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestConcurrentUploadsCannotOverspend(t *testing.T) {
+	inTempDir(t)
+	t.Setenv("EXPRESS_SURCHARGE_SLOTS", "1")
+	db := newTestDB(t)
+	user := models.User{Email: "u@example.com"}
+	db.Create(&user)
+	db.Create(&models.UserCredits{UserID: user.ID, SlotsRemaining: 5})
+
+	h := NewOrderHandler(db, nil)
+	r := gin.New()
+	r.POST("/upload", signedInAs(user.ID), h.Upload)
+
+	// Express uploads cost 2 slots each, so only 2 of these can be paid for
+	const uploads = 8
+	codes := make([]int, uploads)
+	var wg sync.WaitGroup
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, uploadRequest(t, fmt.Sprintf("doc%d.txt", i), true))
+			codes[i] = w.Code
+		}(i)
+	}
+	wg.Wait()
+
+	accepted := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			accepted++
+		case http.StatusForbidden:
+		default:
+			t.Fatalf("unexpected status %d", code)
+		}
+	}
+	var credits models.UserCredits
+	db.Where("user_id = ?", user.ID).First(&credits)
+	var orders int64
+	db.Model(&models.Order{}).Where("user_id = ?", user.ID).Count(&orders)
+
+	if accepted != 2 || orders != 2 || credits.SlotsRemaining != 1 {
+		t.Fatalf("accepted %d uploads, %d orders, %d slots left; want 2, 2, 1", accepted, orders, credits.SlotsRemaining)
+	}
+}
+
+func TestDecrementUserSlotsKeepsConcurrentAdjustments(t *testing.T) {
+	db := newTestDB(t)
+	db.Create(&models.UserCredits{UserID: 1, SlotsRemaining: 100})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := DecrementUserSlots(db, 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var credits models.UserCredits
+	db.Where("user_id = ?", 1).First(&credits)
+	if credits.SlotsRemaining != 80 {
+		t.Fatalf("slots remaining = %d, want 80", credits.SlotsRemaining)
+	}
+}
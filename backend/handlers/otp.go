@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	errOTPInvalid   = errors.New("Invalid or expired verification code")
+	errOTPExpired   = errors.New("Verification code expired")
+	errOTPExhausted = errors.New("Too many incorrect attempts. Please request a new code.")
+)
+
+// otpMaxAttempts is how many wrong guesses an emailed code survives
+func otpMaxAttempts() int {
+	return envInt("OTP_MAX_ATTEMPTS", 5)
+}
+
+// newNumericCode returns a uniformly random code of the given length from crypto/rand
+func newNumericCode(digits int) (string, error) {
+	var code strings.Builder
+	for i := 0; i < digits; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(byte('0' + n.Int64()))
+	}
+	return code.String(), nil
+}
+
+// hashOTP keys the hash (OTP_HASH_KEY): a six-digit code has so little
+// entropy that a plain hash could be reversed by trying all of them
+func hashOTP(email, code string) string {
+	mac := hmac.New(sha256.New, hashKey("OTP_HASH_KEY", "otp"))
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email)) + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// issueOTP replaces any outstanding code for the email and returns a new one
+// (only its hash is stored)
+func issueOTP(db *gorm.DB, email string, ttl time.Duration) (string, error) {
+	code, err := newNumericCode(6)
+	if err != nil {
+		return "", err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("email = ?", email).Delete(&models.VerificationCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.VerificationCode{
+			Email:     email,
+			CodeHash:  hashOTP(email, code),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	return code, err
+}
+
+// consumeOTP checks a code for the email. A correct code is deleted so it
+// works once; every guess counts towards OTP_MAX_ATTEMPTS, after which the
+// code is discarded.
+func consumeOTP(db *gorm.DB, email, code string) error {
+	var vc models.VerificationCode
+	if err := db.Where("email = ?", email).Order("created_at desc").First(&vc).Error; err != nil {
+		return errOTPInvalid
+	}
+	if time.Now().After(vc.ExpiresAt) {
+		db.Delete(&vc)
+		return errOTPExpired
+	}
+
+	// Count the guess before checking it, in one conditional update, so
+	// parallel guesses can't all slip in under the limit
+	max := otpMaxAttempts()
+	result := db.Model(&models.VerificationCode{}).
+		Where("id = ? AND COALESCE(attempts, 0) < ?", vc.ID, max).
+		UpdateColumn("attempts", gorm.Expr("COALESCE(attempts, 0) + 1"))
+	if result.Error != nil {
+		return errOTPInvalid
+	}
+	if result.RowsAffected != 1 {
+		db.Delete(&vc)
+		return errOTPExhausted
+	}
+	if err := db.First(&vc, vc.ID).Error; err != nil {
+		return errOTPInvalid
+	}
+
+	expected := hashOTP(email, strings.TrimSpace(code))
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(vc.CodeHash)) != 1 {
+		if vc.Attempts >= max {
+			db.Delete(&vc)
+			return errOTPExhausted
+		}
+		return errOTPInvalid
+	}
+
+	// Only one request can delete the row, so a code can't be used twice concurrently
+	result = db.Where("id = ?", vc.ID).Delete(&models.VerificationCode{})
+	if result.Error != nil || result.RowsAffected != 1 {
+		return errOTPInvalid
+	}
+	return nil
+}
+
+// DropPlaintextCodes removes the old plaintext code/token columns. Outstanding
+// codes are discarded; users simply request a new one.
+func DropPlaintextCodes(db *gorm.DB) {
+	migrator := db.Migrator()
+	legacy := []struct {
+		model  interface{}
+		column string
+	}{
+		{&models.VerificationCode{}, "code"},
+		{&models.PasswordResetToken{}, "token"},
+	}
+	for _, l := range legacy {
+		if !migrator.HasColumn(l.model, l.column) {
+			continue
+		}
+		db.Where("1 = 1").Delete(l.model)
+		if err := migrator.DropColumn(l.model, l.column); err != nil {
+			log.Printf("Failed to drop plaintext column %s: %v\n", l.column, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"checkmate-backend/models"
+)
+
+// wrongCode returns a six-digit code that isn't code
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestOTPIsStoredHashedAndWorksOnce(t *testing.T) {
+	db := newTestDB(t)
+	code, err := issueOTP(db, "verify:1:u@example.com", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored models.VerificationCode
+	db.First(&stored)
+	if strings.Contains(stored.CodeHash, code) {
+		t.Fatal("code is stored in the clear")
+	}
+	if err := consumeOTP(db, "verify:1:other@example.com", code); err == nil {
+		t.Fatal("code accepted for another key")
+	}
+	if err := consumeOTP(db, "verify:1:u@example.com", code); err != nil {
+		t.Fatalf("valid code rejected: %v", err)
+	}
+	if err := consumeOTP(db, "verify:1:u@example.com", code); err == nil {
+		t.Fatal("code worked twice")
+	}
+}
+
+func TestOTPIsDiscardedAfterMaxAttempts(t *testing.T) {
+	t.Setenv("OTP_MAX_ATTEMPTS", "3")
+	db := newTestDB(t)
+	code, err := issueOTP(db, "k", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Parallel guesses can't get more tries than the limit between them
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consumeOTP(db, "k", wrongCode(code))
+		}()
+	}
+	wg.Wait()
+
+	if err := consumeOTP(db, "k", code); !errors.Is(err, errOTPInvalid) && !errors.Is(err, errOTPExhausted) {
+		t.Fatalf("err = %v, want the code to be gone", err)
+	}
+	var left int64
+	db.Model(&models.VerificationCode{}).Count(&left)
+	if left != 0 {
+		t.Fatal("exhausted code was kept")
+	}
+}
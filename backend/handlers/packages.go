@@ -31,6 +31,7 @@ func (h *PackageHandler) AdminCreatePackage(c *gin.Context) {
 		return
 	}
 	h.DB.Create(&pkg)
+	recordAuditChange(c, h.DB, "package.create", "package", pkg.ID, nil, pkg, nil)
 	c.JSON(http.StatusOK, pkg)
 }
 
@@ -43,6 +44,8 @@ func (h *PackageHandler) AdminUpdatePackage(c *gin.Context) {
 		return
 	}
 
+	before := pkg
+
 	// Bind to a generic map to handle boolean false updates correctly if needed,
 	// but mapping to struct works if we trust the client sends all fields or we manually checks.
 	// For "unavailable", if false is sent, it acts as false.
@@ -53,12 +56,19 @@ func (h *PackageHandler) AdminUpdatePackage(c *gin.Context) {
 	}
 
 	h.DB.Save(&pkg)
+	recordAuditChange(c, h.DB, "package.update", "package", pkg.ID, before, pkg, nil)
 	c.JSON(http.StatusOK, pkg)
 }
 
 // AdminDeletePackage
 func (h *PackageHandler) AdminDeletePackage(c *gin.Context) {
 	id := c.Param("id")
-	h.DB.Delete(&models.PricingPackage{}, id)
+	var pkg models.PricingPackage
+	if err := h.DB.First(&pkg, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Package not found"})
+		return
+	}
+	h.DB.Delete(&pkg)
+	recordAuditChange(c, h.DB, "package.delete", "package", pkg.ID, pkg, nil, nil)
 	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
 }
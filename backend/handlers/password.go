@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPasswordBytes is bcrypt's input limit; anything longer would be
+// silently truncated or rejected by the hashing library
+const maxPasswordBytes = 72
+
+// breachedPasswords is the bundled list of SHA-1 hashes of common and
+// breached passwords, so the check works offline
+//
+//go:embed passwords/breached.txt
+var breachedPasswords string
+
+var (
+	breachedOnce  sync.Once
+	breachedIndex map[string]map[string]bool // 5-character hash prefix -> suffixes
+)
+
+// passwordPolicy is read from the environment on each check so it can be
+// tuned without a rebuild
+type passwordPolicy struct {
+	MinLength      int  `json:"min_length"`
+	MaxLength      int  `json:"max_length"`
+	MinEntropyBits int  `json:"min_entropy_bits"`
+	BreachCheck    bool `json:"breach_check"`
+}
+
+func currentPasswordPolicy() passwordPolicy {
+	return passwordPolicy{
+		MinLength:      envInt("PASSWORD_MIN_LENGTH", 8),
+		MaxLength:      maxPasswordBytes,
+		MinEntropyBits: envInt("PASSWORD_MIN_ENTROPY_BITS", 35),
+		BreachCheck:    envBool("PASSWORD_BREACH_CHECK", true),
+	}
+}
+
+// checkPasswordPolicy validates a new password. email is the account's
+// address, which the password must not contain.
+func checkPasswordPolicy(password, email string) error {
+	policy := currentPasswordPolicy()
+	length := len([]rune(password))
+	if length < policy.MinLength {
+		return fmt.Errorf("Password must be at least %d characters", policy.MinLength)
+	}
+	if len(password) > policy.MaxLength {
+		return fmt.Errorf("Password must be at most %d bytes", policy.MaxLength)
+	}
+	if strings.TrimSpace(password) == "" {
+		return errors.New("Password can't be only spaces")
+	}
+
+	lower := strings.ToLower(password)
+	if local, _, _ := strings.Cut(strings.ToLower(email), "@"); len(local) >= 4 && strings.Contains(lower, local) {
+		return errors.New("Password must not contain your email address")
+	}
+	// Capitalising the first letter is the usual tweak, so check the lower-case form too
+	if policy.BreachCheck && (passwordBreached(password) || passwordBreached(lower)) {
+		return errors.New("This password appears in lists of breached or common passwords. Choose a different one.")
+	}
+	if passwordEntropy(password) < float64(policy.MinEntropyBits) {
+		return errors.New("Password is too easy to guess. Make it longer, or mix in capitals, numbers or symbols.")
+	}
+	return nil
+}
+
+// rejectWeakPassword answers 400 with the reason if the password fails the policy
+func rejectWeakPassword(c *gin.Context, password, email string) bool {
+	err := checkPasswordPolicy(password, email)
+	if err == nil {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "weak_password": true})
+	return true
+}
+
+// passwordEntropy is a rough estimate in bits: the size of the character
+// pool each character draws from, with repeats ("aaaa") and runs ("abcd",
+// "1234") counting for less
+func passwordEntropy(password string) float64 {
+	var hasLower, hasUpper, hasDigit, hasSymbol, hasOther bool
+	runes := []rune(password)
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			hasLower = true
+		case r >= 'A' && r <= 'Z':
+			hasUpper = true
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			hasSymbol = true
+		default:
+			hasOther = true
+		}
+	}
+	pool := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{hasLower, 26}, {hasUpper, 26}, {hasDigit, 10}, {hasSymbol, 33}, {hasOther, 100}} {
+		if class.present {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	effective := 0.0
+	for i, r := range runes {
+		switch {
+		case i == 0:
+			effective++
+		case r == runes[i-1]:
+			effective += 0.25
+		case r-runes[i-1] == 1 || r-runes[i-1] == -1:
+			effective += 0.5
+		default:
+			effective++
+		}
+	}
+	return effective * math.Log2(float64(pool))
+}
+
+// passwordBreached looks the password up by SHA-1, k-anonymity style: the
+// index is bucketed by the first five hex characters of the hash, and only
+// that bucket is searched
+func passwordBreached(password string) bool {
+	breachedOnce.Do(loadBreachedPasswords)
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return breachedIndex[hash[:5]][hash[5:]]
+}
+
+// loadBreachedPasswords indexes the bundled list, plus BREACHED_PASSWORDS_FILE
+// if set (same format, e.g. a trimmed Pwned Passwords SHA-1 download)
+func loadBreachedPasswords() {
+	breachedIndex = map[string]map[string]bool{}
+	indexBreachedPasswords(strings.NewReader(breachedPasswords))
+
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Printf("[PASSWORD] Failed to open %s: %v\n", path, err)
+			return
+		}
+		defer file.Close()
+		indexBreachedPasswords(file)
+	}
+
+	count := 0
+	for _, suffixes := range breachedIndex {
+		count += len(suffixes)
+	}
+	fmt.Printf("[PASSWORD] Loaded %d breached password hashes\n", count)
+}
+
+// indexBreachedPasswords reads "HASH" or "HASH:COUNT" lines, skipping
+// blanks and # comments
+func indexBreachedPasswords(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != sha1.Size*2 {
+			continue
+		}
+		bucket := breachedIndex[hash[:5]]
+		if bucket == nil {
+			bucket = map[string]bool{}
+			breachedIndex[hash[:5]] = bucket
+		}
+		bucket[hash[5:]] = true
+	}
+}
+
+// GetPasswordPolicy tells the signup and reset forms what passwords must meet
+func (h *AuthHandler) GetPasswordPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, currentPasswordPolicy())
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"checkmate-backend/models"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -335,17 +336,24 @@ func (h *PaymentHandler) GetUserCredits(c *gin.Context) {
 
 // DecrementUserSlots - Helper function to decrease slots after upload
 func DecrementUserSlots(db *gorm.DB, userID uint) error {
-	var userCredits models.UserCredits
-	if err := db.Where("user_id = ?", userID).First(&userCredits).Error; err != nil {
-		return fmt.Errorf("user credits not found")
-	}
+	return DecrementUserSlotsBy(db, userID, 1)
+}
 
-	if userCredits.SlotsRemaining <= 0 {
-		return fmt.Errorf("insufficient slots")
-	}
+// errInsufficientSlots is returned when a charge would take the balance below zero
+var errInsufficientSlots = errors.New("insufficient slots")
 
-	userCredits.SlotsRemaining--
-	return db.Save(&userCredits).Error
+// DecrementUserSlotsBy - Helper to charge several slots at once (e.g. express uploads).
+// The balance check is part of the update, so concurrent charges can't overspend.
+func DecrementUserSlotsBy(db *gorm.DB, userID uint, slots int) error {
+	result := db.Model(&models.UserCredits{}).Where("user_id = ? AND slots_remaining >= ?", userID, slots).
+		UpdateColumn("slots_remaining", gorm.Expr("slots_remaining - ?", slots))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return errInsufficientSlots
+	}
+	return nil
 }
 
 // CheckUserSlots - Helper to check if user has slots
@@ -455,13 +463,22 @@ func (h *PaymentHandler) AdminVerifyTransaction(c *gin.Context) {
 			return
 		}
 
+		recordAuditChange(c, h.DB, "transaction.verify", "transaction", transaction.ID,
+			gin.H{"status": transaction.Status}, gin.H{"status": models.TransactionCompleted},
+			gin.H{"reference": reference, "gateway_status": gatewayStatus, "user_id": transaction.UserID, "slots": transaction.SlotsPurchased})
 		c.JSON(http.StatusOK, gin.H{"status": "completed", "message": "Transaction verified and completed"})
 
 	} else if gatewayStatus == "failed" || gatewayStatus == "reversed" {
+		before := transaction.Status
 		transaction.Status = models.TransactionFailed
 		h.DB.Save(&transaction)
+		recordAuditChange(c, h.DB, "transaction.verify", "transaction", transaction.ID,
+			gin.H{"status": before}, gin.H{"status": transaction.Status},
+			gin.H{"reference": reference, "gateway_status": gatewayStatus, "user_id": transaction.UserID})
 		c.JSON(http.StatusOK, gin.H{"status": "failed"})
 	} else {
+		recordAudit(c, h.DB, "transaction.verify", "transaction", transaction.ID,
+			gin.H{"reference": reference, "gateway_status": gatewayStatus, "user_id": transaction.UserID})
 		c.JSON(http.StatusOK, gin.H{"status": "pending", "message": "Transaction is still pending at gateway"})
 	}
 }
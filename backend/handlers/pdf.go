@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// pdfPage is a minimal single-page PDF writer (A4, standard Helvetica fonts).
+// It covers what the order summary needs: text, filled boxes and rules.
+type pdfPage struct {
+	content bytes.Buffer
+}
+
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+)
+
+// fill sets the fill colour (0-255 RGB) for following shapes and text
+func (p *pdfPage) fill(r, g, b int) {
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f rg\n", float64(r)/255, float64(g)/255, float64(b)/255)
+}
+
+// rect draws a filled rectangle; y is measured from the top of the page
+func (p *pdfPage) rect(x, y, w, h float64) {
+	fmt.Fprintf(&p.content, "%.2f %.2f %.2f %.2f re f\n", x, pdfPageHeight-y-h, w, h)
+}
+
+// rule draws a thin horizontal line; y is measured from the top of the page
+func (p *pdfPage) rule(x1, x2, y float64) {
+	fmt.Fprintf(&p.content, "0.85 0.85 0.85 RG 0.75 w %.2f %.2f m %.2f %.2f l S\n", x1, pdfPageHeight-y, x2, pdfPageHeight-y)
+}
+
+// text writes a single line of text; y is the baseline measured from the top
+func (p *pdfPage) text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.content, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, pdfPageHeight-y, pdfEscape(s))
+}
+
+// pdfFit shortens s with "..." so it fits in width points at size. Widths
+// are estimated from a generous average Helvetica character width.
+func pdfFit(s string, size, width float64) string {
+	runes := []rune(s)
+	max := int(width / (size * 0.6))
+	if len(runes) <= max || max < 4 {
+		return s
+	}
+	return string(runes[:max-3]) + "..."
+}
+
+// pdfEscape makes s safe for a PDF literal string. Characters outside
+// Latin-1 cannot be shown with the standard fonts and become '?'.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32:
+			b.WriteByte(' ')
+		case r > 255:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
+
+// bytes assembles the complete PDF file
+func (p *pdfPage) bytes() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>", pdfPageWidth, pdfPageHeight),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.String()),
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"archive/zip"
+	"checkmate-backend/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ExportData streams a ZIP of everything stored about the user: profile,
+// sign-in methods, sessions, transactions, orders with their reports and
+// messages, and the files behind them
+func (h *ProfileHandler) ExportData(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	h.DB.Model(&user).Association("Roles").Find(&user.Roles)
+
+	var identities []models.UserIdentity
+	h.DB.Where("user_id = ?", user.ID).Find(&identities)
+	var sessions []models.Session
+	h.DB.Where("user_id = ?", user.ID).Order("created_at desc").Find(&sessions)
+	var transactions []models.Transaction
+	h.DB.Where("user_id = ?", user.ID).Order("created_at desc").Find(&transactions)
+	var orders []models.Order
+	h.DB.Preload("Reports").Where("user_id = ?", user.ID).Order("created_at desc").Find(&orders)
+
+	type exportedOrder struct {
+		models.Order
+		Messages []models.OrderMessage `json:"messages"`
+	}
+	exported := make([]exportedOrder, 0, len(orders))
+	for _, order := range orders {
+		var messages []models.OrderMessage
+		h.DB.Where("order_id = ?", order.ID).Order("created_at asc").Find(&messages)
+		order.User = models.User{} // Already in profile.json
+		exported = append(exported, exportedOrder{Order: order, Messages: messages})
+	}
+	for i := range transactions {
+		transactions[i].User = models.User{}
+	}
+
+	recordAudit(c, h.DB, "user.export", "user", user.ID, nil)
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="checkmate-export-%d.zip"`, user.ID))
+	archive := zip.NewWriter(c.Writer)
+	defer archive.Close()
+
+	writeJSON := func(name string, value interface{}) {
+		w, err := archive.Create(name)
+		if err != nil {
+			return
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(value)
+	}
+	writeJSON("profile.json", gin.H{
+		"profile":     profileResponse(user),
+		"roles":       user.Roles,
+		"identities":  identities,
+		"sessions":    sessions,
+		"exported_at": time.Now(),
+	})
+	writeJSON("transactions.json", transactions)
+	writeJSON("orders.json", exported)
+
+	// Files that are still on disk (old ones are removed by the cleanup job)
+	for _, order := range exported {
+		folder := fmt.Sprintf("orders/%d/", order.ID)
+		addFileToZip(archive, order.LocalFilePath, folder+filepath.Base(order.OriginalFilename))
+		for _, report := range order.Reports {
+			if report.FilePath != "" {
+				addFileToZip(archive, filepath.Join("uploads", report.FilePath), folder+"reports/"+filepath.Base(report.FileName))
+			}
+		}
+		for _, message := range order.Messages {
+			if message.AttachmentPath != "" {
+				addFileToZip(archive, filepath.Join("uploads", message.AttachmentPath),
+					fmt.Sprintf("%smessages/%d-%s", folder, message.ID, filepath.Base(message.AttachmentName)))
+			}
+		}
+	}
+}
+
+// addFileToZip copies a file into the archive, skipping it if it is gone
+func addFileToZip(archive *zip.Writer, path, name string) {
+	if path == "" {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	w, err := archive.Create(name)
+	if err != nil {
+		return
+	}
+	io.Copy(w, file)
+}
+
+// DeleteAccount erases the user's data and anonymises the account. Orders,
+// their files and messages are purged; transactions are kept (without the
+// phone number) because payment records must be retained.
+func (h *ProfileHandler) DeleteAccount(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Confirm  string `json:"confirm"` // Must repeat the account email
+		Password string `json:"password"`
+	}
+	if c.BindJSON(&body) != nil || !strings.EqualFold(strings.TrimSpace(body.Confirm), user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Type your email address to confirm"})
+		return
+	}
+	if user.PasswordHash != "" && !checkPassword(c, h.DB, &user, body.Password) {
+		return
+	}
+
+	var roles int64
+	h.DB.Table("user_roles").Where("user_id = ?", user.ID).Count(&roles)
+	if roles > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Staff accounts must have their roles removed before they can be deleted"})
+		return
+	}
+
+	// Files first: removeOrderFiles reads the report and message rows
+	var orders []models.Order
+	h.DB.Unscoped().Where("user_id = ?", user.ID).Find(&orders)
+	for _, order := range orders {
+		removeOrderFiles(h.DB, order)
+	}
+
+	email := user.Email
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		orderIDs := tx.Unscoped().Model(&models.Order{}).Select("id").Where("user_id = ?", user.ID)
+		if err := tx.Where("order_id IN (?)", orderIDs).Delete(&models.Report{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("order_id IN (?)", orderIDs).Delete(&models.OrderMessage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Order{}).Error; err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{
+			&models.Session{}, &models.RefreshToken{}, &models.RecoveryCode{}, &models.UserIdentity{},
+			&models.PushSubscription{}, &models.MagicLinkToken{}, &models.OIDCLogin{}, &models.UserCredits{},
+		} {
+			if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		tx.Where("email = ?", email).Delete(&models.PasswordResetToken{})
+		// Codes are keyed by account (and the address being confirmed), not the bare address
+		tx.Where("email = ? OR email LIKE ? OR email = ?", email, fmt.Sprintf("verify:%d:%%", user.ID), fmt.Sprintf("email-change:%d", user.ID)).
+			Delete(&models.VerificationCode{})
+
+		// Financial records stay, minus personal details
+		if err := tx.Model(&models.Transaction{}).Where("user_id = ?", user.ID).Update("phone_number", "").Error; err != nil {
+			return err
+		}
+
+		// Anonymise, then soft-delete so foreign keys in kept records still resolve
+		err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"first_name":     "Deleted",
+			"last_name":      "User",
+			"email":          fmt.Sprintf("deleted-%d@deleted.invalid", user.ID),
+			"password_hash":  "",
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+			"is_admin":       false,
+			"locked_until":   nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, user.ID).Error
+	})
+	if err != nil {
+		fmt.Printf("[ACCOUNT] Failed to delete user %d: %v\n", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	fmt.Printf("[ACCOUNT] User %d deleted their account (%d orders purged)\n", user.ID, len(orders))
+	recordAudit(c, h.DB, "user.delete", "user", user.ID, gin.H{"orders_purged": len(orders)})
+	go func() {
+		if err := sendEmail(email, "Your Checkmate account was deleted",
+			"Your Checkmate account and documents have been deleted. Payment records are kept as required by law, without your contact details."); err != nil {
+			fmt.Println("SMTP Error:", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Your account has been deleted"})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"checkmate-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// rowsMentioning counts rows in every table with a text column containing s
+func rowsMentioning(t *testing.T, db *gorm.DB, s string) map[string]int64 {
+	t.Helper()
+	var tables []string
+	db.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'").Scan(&tables)
+	found := map[string]int64{}
+	for _, table := range tables {
+		var columns []struct {
+			Name string
+			Type string
+		}
+		db.Raw("SELECT name, type FROM pragma_table_info(?)", table).Scan(&columns)
+		for _, column := range columns {
+			if !strings.EqualFold(column.Type, "text") {
+				continue
+			}
+			var n int64
+			db.Table(table).Where(fmt.Sprintf("%q LIKE ?", column.Name), "%"+s+"%").Count(&n)
+			if n > 0 {
+				found[table+"."+column.Name] += n
+			}
+		}
+	}
+	return found
+}
+
+func TestDeleteAccountLeavesNoTraceOfTheAddress(t *testing.T) {
+	inTempDir(t)
+	db := newTestDB(t)
+	user := models.User{Email: "Leaving@Example.com"}
+	db.Create(&user)
+	other := models.User{Email: "staying@example.com"}
+	db.Create(&other)
+
+	// Outstanding codes for the current address, a pending move and its confirmation
+	for _, key := range []string{
+		verificationKey(user.ID, user.Email),
+		verificationKey(user.ID, "new-address@example.com"),
+		fmt.Sprintf("email-change:%d", user.ID),
+		verificationKey(other.ID, other.Email),
+	} {
+		if _, err := issueOTP(db, key, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Create(&models.PasswordResetToken{Email: user.Email, TokenHash: "x", ExpiresAt: time.Now().Add(time.Hour)})
+
+	r := gin.New()
+	r.DELETE("/user/account", signedInAs(user.ID), NewProfileHandler(db).DeleteAccount)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "/user/account", bytes.NewBufferString(`{"confirm":"leaving@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	if found := rowsMentioning(t, db, "leaving@example.com"); len(found) > 0 {
+		t.Fatalf("old address still stored in %v", found)
+	}
+	var codes []models.VerificationCode
+	db.Find(&codes)
+	if len(codes) != 1 || codes[0].Email != verificationKey(other.ID, other.Email) {
+		t.Fatalf("codes left after deletion: %+v", codes)
+	}
+}
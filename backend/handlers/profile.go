@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type ProfileHandler struct {
+	DB *gorm.DB
+}
+
+func NewProfileHandler(db *gorm.DB) *ProfileHandler {
+	return &ProfileHandler{DB: db}
+}
+
+// currentUser loads the signed-in user, answering 404 if they are gone
+func (h *ProfileHandler) currentUser(c *gin.Context) (models.User, bool) {
+	userID, _ := c.Get("userID")
+	var user models.User
+	if err := h.DB.Preload("Credits").First(&user, uint(userID.(float64))).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return user, false
+	}
+	return user, true
+}
+
+func profileResponse(user models.User) gin.H {
+	return gin.H{
+		"id":              user.ID,
+		"first_name":      user.FirstName,
+		"last_name":       user.LastName,
+		"email":           user.Email,
+		"email_verified":  user.EmailVerified,
+		"has_password":    user.PasswordHash != "",
+		"totp_enabled":    user.TOTPEnabled,
+		"slots_remaining": user.Credits.SlotsRemaining,
+		"created_at":      user.CreatedAt,
+	}
+}
+
+// checkPassword verifies the user's current password, counting failures
+// towards the login lockout so a stolen session can't guess it
+func checkPassword(c *gin.Context, db *gorm.DB, user *models.User, password string) bool {
+	if rejectIfLocked(c, user) {
+		return false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		recordLoginFailure(c, db, user)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is incorrect"})
+		return false
+	}
+	return true
+}
+
+// GetProfile returns the signed-in user's profile
+func (h *ProfileHandler) GetProfile(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, profileResponse(user))
+}
+
+// UpdateProfile changes the user's name
+func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+	}
+	if c.BindJSON(&body) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	body.FirstName, body.LastName = strings.TrimSpace(body.FirstName), strings.TrimSpace(body.LastName)
+	if body.FirstName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "First name is required"})
+		return
+	}
+
+	user.FirstName, user.LastName = body.FirstName, body.LastName
+	if err := h.DB.Model(&user).Updates(map[string]interface{}{"first_name": user.FirstName, "last_name": user.LastName}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+	c.JSON(http.StatusOK, profileResponse(user))
+}
+
+// RequestEmailChange emails a verification code to the new address. Accounts
+// with a password must confirm it first; accounts without one confirm a code
+// sent to their current address.
+func (h *ProfileHandler) RequestEmailChange(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Email       string `json:"email"`
+		Password    string `json:"password"`
+		CurrentCode string `json:"current_code"` // Accounts without a password
+	}
+	if c.BindJSON(&body) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	email := strings.TrimSpace(body.Email)
+	if !strings.Contains(email, "@") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enter a valid email address"})
+		return
+	}
+	if strings.EqualFold(email, user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "That is already your email address"})
+		return
+	}
+	if user.PasswordHash != "" {
+		if !checkPassword(c, h.DB, &user, body.Password) {
+			return
+		}
+	} else if !h.confirmCurrentAddress(c, user, body.CurrentCode) {
+		return
+	}
+
+	var taken int64
+	whereEmail(h.DB.Model(&models.User{}), email).Count(&taken)
+	if taken > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "That email address is already in use"})
+		return
+	}
+
+	if err := sendVerificationCode(h.DB, user, email); err != nil {
+		respondSendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification code sent to " + email})
+}
+
+// confirmCurrentAddress re-authenticates an account without a password
+// before its email changes: without a code it emails one to the current
+// address and asks for it, with one it checks it
+func (h *ProfileHandler) confirmCurrentAddress(c *gin.Context, user models.User, code string) bool {
+	key := fmt.Sprintf("email-change:%d", user.ID)
+	if strings.TrimSpace(code) == "" {
+		otp, err := issueOTP(h.DB, key, verificationCodeTTL)
+		if err == nil {
+			err = sendEmail(user.Email, "Confirm your Checkmate email change",
+				fmt.Sprintf("Someone asked to move your Checkmate account to a new email address. If it was you, enter this code to continue: %s\n\nIt expires in %d minutes. If it wasn't you, ignore this email.",
+					otp, int(verificationCodeTTL.Minutes())))
+		}
+		if err != nil {
+			respondSendError(c, err)
+			return false
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"current_code_required": true,
+			"message":               "We sent a code to " + user.Email + ". Enter it to continue.",
+		})
+		return false
+	}
+	if err := consumeOTP(h.DB, key, code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// ConfirmEmailChange switches to the new address once its code is verified;
+// the new address counts as verified and other sessions are signed out
+func (h *ProfileHandler) ConfirmEmailChange(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+	if c.BindJSON(&body) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	email := strings.TrimSpace(body.Email)
+
+	if err := confirmVerificationCode(c, h.DB, &user, email, body.Code); err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, profileResponse(user))
+}
+
+// ChangePassword replaces the password after checking the current one, and
+// signs out every other session
+func (h *ProfileHandler) ChangePassword(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if c.BindJSON(&body) != nil || body.NewPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password is required"})
+		return
+	}
+	if user.PasswordHash == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Your account has no password yet. Add one under Sign-in Methods."})
+		return
+	}
+	if !checkPassword(c, h.DB, &user, body.CurrentPassword) {
+		return
+	}
+	if rejectWeakPassword(c, body.NewPassword, user.Email) {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), 10)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	if err := h.DB.Model(&user).Update("password_hash", string(hash)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	sessionID, _ := c.Get("sessionID")
+	currentSession, _ := sessionID.(uint)
+	revokeOtherSessions(h.DB, user.ID, currentSession)
+	h.DB.Where("email = ?", user.Email).Delete(&models.PasswordResetToken{})
+	resetLoginFailures(h.DB, &user)
+	recordAudit(c, h.DB, "user.password_change", "user", user.ID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed. Other devices have been signed out."})
+}
+
+// ListPurchases returns the user's payment history, newest first
+func (h *ProfileHandler) ListPurchases(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var transactions []models.Transaction
+	if err := h.DB.Where("user_id = ?", userID).Order("created_at desc").Find(&transactions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchases"})
+		return
+	}
+
+	purchases := make([]gin.H, 0, len(transactions))
+	totalSpent, totalSlots := 0.0, 0
+	for _, tx := range transactions {
+		purchases = append(purchases, gin.H{
+			"id":                tx.ID,
+			"amount":            tx.Amount,
+			"slots_purchased":   tx.SlotsPurchased,
+			"payment_reference": tx.PaymentReference,
+			"status":            tx.Status,
+			"created_at":        tx.CreatedAt,
+		})
+		if tx.Status == models.TransactionCompleted {
+			totalSpent += tx.Amount
+			totalSlots += tx.SlotsPurchased
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"purchases":   purchases,
+		"total_spent": totalSpent,
+		"total_slots": totalSlots,
+	})
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MigrateLegacyReports moves the old Report1Path/Report2Path columns on orders
+// into Report rows and then drops the columns. Safe to run on every startup.
+func MigrateLegacyReports(db *gorm.DB) {
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&models.Order{}, "report1_path") {
+		return
+	}
+
+	var legacy []struct {
+		ID          uint
+		AIScore     int
+		SimScore    int
+		Report1Path string
+		Report2Path string
+	}
+	db.Table("orders").
+		Select("id, ai_score, sim_score, report1_path, report2_path").
+		Where("report1_path <> '' OR report2_path <> ''").
+		Where("NOT EXISTS (SELECT 1 FROM reports WHERE reports.order_id = orders.id)").
+		Scan(&legacy)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range legacy {
+			// report1 was always the plagiarism report, report2 the AI report
+			if row.Report1Path != "" {
+				score := row.SimScore
+				report := models.Report{OrderID: row.ID, Type: models.ReportSimilarity, Score: &score, FilePath: row.Report1Path, FileName: storedOriginalName(row.Report1Path), GeneratedBy: "migration"}
+				if err := tx.Create(&report).Error; err != nil {
+					return err
+				}
+			}
+			if row.Report2Path != "" {
+				score := row.AIScore
+				report := models.Report{OrderID: row.ID, Type: models.ReportAI, Score: &score, FilePath: row.Report2Path, FileName: storedOriginalName(row.Report2Path), GeneratedBy: "migration"}
+				if err := tx.Create(&report).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("Failed to migrate legacy report columns:", err)
+		return
+	}
+
+	for _, column := range []string{"report1_path", "report2_path"} {
+		if err := migrator.DropColumn(&models.Order{}, column); err != nil {
+			log.Printf("Failed to drop legacy column %s: %v\n", column, err)
+		}
+	}
+	log.Printf("Migrated %d orders to structured reports\n", len(legacy))
+}
+
+// storedOriginalName strips the "report_<order>_<timestamp>_" prefix from a stored filename
+func storedOriginalName(stored string) string {
+	parts := strings.SplitN(stored, "_", 4)
+	if len(parts) == 4 && parts[0] == "report" {
+		return parts[3]
+	}
+	return stored
+}
+
+// completionFields are the form fields for the reports staff upload by hand
+var completionFields = []struct {
+	reportType  models.ReportType
+	score, file string
+}{
+	{models.ReportSimilarity, "sim_score", "report1"},
+	{models.ReportAI, "ai_score", "report2"},
+}
+
+// applyCompletion stores the report files, scores and optional structured
+// findings posted with the request, marks the order completed (recording
+// whether the SLA was met) and saves everything.
+//
+// Form fields: ai_score, sim_score, report1 (similarity PDF), report2 (AI PDF)
+// and findings, a JSON array of {type, score, matched_sources, sections}.
+func applyCompletion(c *gin.Context, db *gorm.DB, order *models.Order, generatedBy string) error {
+	var findings []models.Report
+	if raw := c.PostForm("findings"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &findings); err != nil {
+			return fmt.Errorf("invalid findings JSON")
+		}
+	}
+
+	// Scores typed into the form win over those in the findings; a blank
+	// field means no score rather than 0
+	formScores := map[models.ReportType]*int{}
+	for _, field := range completionFields {
+		raw := strings.TrimSpace(c.PostForm(field.score))
+		if raw == "" {
+			continue
+		}
+		score, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid scores: ai_score and sim_score must be whole numbers")
+		}
+		formScores[field.reportType] = &score
+	}
+
+	var existing []models.Report
+	db.Where("order_id = ?", order.ID).Find(&existing)
+	var reports []*models.Report
+	findReport := func(reportType models.ReportType) *models.Report {
+		for _, report := range reports {
+			if report.Type == reportType {
+				return report
+			}
+		}
+		return nil
+	}
+	reportFor := func(reportType models.ReportType) *models.Report {
+		if report := findReport(reportType); report != nil {
+			return report
+		}
+		report := &models.Report{OrderID: order.ID, Type: reportType}
+		reports = append(reports, report)
+		return report
+	}
+	for i := range existing {
+		reports = append(reports, &existing[i])
+	}
+
+	// Handle Report Uploads
+	saveReport := func(fileHeader *multipart.FileHeader, report *models.Report) {
+		if fileHeader == nil {
+			return
+		}
+		timestamp := time.Now().Unix()
+		filename := fmt.Sprintf("report_%d_%d_%s", order.ID, timestamp, fileHeader.Filename)
+		dst := filepath.Join("./uploads", filename)
+		if err := c.SaveUploadedFile(fileHeader, dst); err != nil {
+			return
+		}
+		report.FilePath = filename
+		report.FileName = fileHeader.Filename
+		report.SHA256 = fileSHA256(dst)
+	}
+
+	// Only reports that were actually provided (a file or a score) are created
+	for _, field := range completionFields {
+		fileHeader, _ := c.FormFile(field.file)
+		if fileHeader == nil && formScores[field.reportType] == nil {
+			continue
+		}
+		report := reportFor(field.reportType)
+		if score := formScores[field.reportType]; score != nil {
+			report.Score = score
+		}
+		saveReport(fileHeader, report)
+	}
+
+	for _, finding := range findings {
+		if finding.Type == "" {
+			continue
+		}
+		report := reportFor(finding.Type)
+		if finding.Score != nil && formScores[finding.Type] == nil {
+			report.Score = finding.Score
+		}
+		report.MatchedSources = finding.MatchedSources
+		report.Sections = finding.Sections
+	}
+
+	now := time.Now()
+	slaMet := order.DueAt == nil || !now.After(*order.DueAt)
+	order.Status = models.StatusCompleted
+	if report := findReport(models.ReportAI); report != nil && report.Score != nil {
+		order.AIScore = *report.Score
+	}
+	if report := findReport(models.ReportSimilarity); report != nil && report.Score != nil {
+		order.SimScore = *report.Score
+	}
+	order.CompletedAt = &now
+	order.SLAMet = &slaMet
+	order.ClaimExpiresAt = nil
+	if order.ClaimedAt == nil {
+		order.ClaimedAt = &now
+	}
+
+	// Summary certificate so there is always something to download
+	if order.VerificationCode == nil {
+		code, err := newVerificationCode()
+		if err != nil {
+			return fmt.Errorf("failed to issue verification code")
+		}
+		order.VerificationCode = &code
+	}
+	if order.WordCount == 0 {
+		order.WordCount = countWords(order.LocalFilePath)
+	}
+	if filename, err := writeSummaryPDF(order, reports); err != nil {
+		fmt.Printf("Failed to generate summary PDF for order %d: %v\n", order.ID, err)
+	} else {
+		summary := reportFor(models.ReportSummary)
+		if summary.FilePath != "" {
+			os.Remove(filepath.Join("uploads", summary.FilePath))
+		}
+		summary.FilePath = filename
+		summary.SHA256 = fileSHA256(filepath.Join("uploads", filename))
+		summary.FileName = strings.TrimSuffix(order.OriginalFilename, filepath.Ext(order.OriginalFilename)) + "-summary.pdf"
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Reports", "User", "Assignee").Save(order).Error; err != nil {
+			return err
+		}
+		for _, report := range reports {
+			report.GeneratedBy = generatedBy
+			if err := tx.Save(report).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("order_id = ?", order.ID).Order("id asc").Find(&order.Reports).Error
+	})
+}
+
+// ListReports returns the structured reports for one of the user's orders
+func (h *OrderHandler) ListReports(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var order models.Order
+	if err := h.DB.Preload("Reports").First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	if order.UserID != uint(userID.(float64)) && !userCan(h.DB, userID, models.PermOrdersView) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	if order.Status != models.StatusCompleted {
+		c.JSON(http.StatusOK, []models.Report{})
+		return
+	}
+
+	c.JSON(http.StatusOK, order.Reports)
+}
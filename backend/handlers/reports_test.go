@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"checkmate-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// complete posts a completion form for the order and returns its reports by type
+func complete(t *testing.T, fields map[string]string) (models.Order, map[models.ReportType]models.Report) {
+	t.Helper()
+	inTempDir(t)
+	db := newTestDB(t)
+	order := models.Order{UserID: 1, Status: models.StatusProcessing, OriginalFilename: "essay.txt"}
+	db.Create(&order)
+
+	r := gin.New()
+	r.POST("/complete", func(c *gin.Context) {
+		if err := applyCompletion(c, db, &order, "admin:1"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/complete", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("completion failed: %d %s", w.Code, w.Body.String())
+	}
+
+	reports := map[models.ReportType]models.Report{}
+	for _, report := range order.Reports {
+		reports[report.Type] = report
+	}
+	return order, reports
+}
+
+func TestCompletionWithoutScoresCreatesNoScoreReports(t *testing.T) {
+	_, reports := complete(t, map[string]string{"ai_score": "", "sim_score": ""})
+	if _, ok := reports[models.ReportAI]; ok {
+		t.Error("AI report created without a file or score")
+	}
+	if _, ok := reports[models.ReportSimilarity]; ok {
+		t.Error("similarity report created without a file or score")
+	}
+	if _, ok := reports[models.ReportSummary]; !ok {
+		t.Error("summary certificate missing")
+	}
+}
+
+func TestCompletionUsesFindingScoresUnlessTyped(t *testing.T) {
+	order, reports := complete(t, map[string]string{
+		"sim_score": "12",
+		"findings":  `[{"type":"ai","score":37},{"type":"similarity","score":80}]`,
+	})
+	if ai := reports[models.ReportAI]; ai.Score == nil || *ai.Score != 37 {
+		t.Errorf("AI score = %v, want 37 from the findings", ai.Score)
+	}
+	if sim := reports[models.ReportSimilarity]; sim.Score == nil || *sim.Score != 12 {
+		t.Errorf("similarity score = %v, want the typed 12", sim.Score)
+	}
+	if order.AIScore != 37 || order.SimScore != 12 {
+		t.Errorf("order scores = %d/%d, want 37/12", order.AIScore, order.SimScore)
+	}
+}
+
+func TestCompletionRejectsNonNumericScores(t *testing.T) {
+	inTempDir(t)
+	db := newTestDB(t)
+	order := models.Order{UserID: 1, Status: models.StatusProcessing}
+	db.Create(&order)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("ai_score", "lots")
+	form.Close()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/complete", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+	if err := applyCompletion(c, db, &order, "admin:1"); err == nil {
+		t.Fatal("non-numeric score was accepted")
+	}
+}
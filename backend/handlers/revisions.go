@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// findPreviousVersion loads the order a re-check builds on. Old orders are
+// soft-deleted by the cleanup job, so they are looked up unscoped.
+func findPreviousVersion(db *gorm.DB, id string, userID uint) (*models.Order, error) {
+	var previous models.Order
+	if err := db.Unscoped().First(&previous, id).Error; err != nil {
+		return nil, fmt.Errorf("previous order not found")
+	}
+	if previous.UserID != userID {
+		return nil, fmt.Errorf("you can only re-check your own orders")
+	}
+	if previous.Status != models.StatusCompleted {
+		return nil, fmt.Errorf("previous order has not been completed yet")
+	}
+	return &previous, nil
+}
+
+// maxRecheckHops bounds the walk back to the first version, so a corrupt
+// chain can't loop forever
+const maxRecheckHops = 100
+
+// rootVersion follows PreviousOrderID back to the first upload of a document
+func rootVersion(db *gorm.DB, order *models.Order) *models.Order {
+	root := order
+	for i := 0; i < maxRecheckHops && root.PreviousOrderID != nil; i++ {
+		var parent models.Order
+		if err := db.Unscoped().First(&parent, *root.PreviousOrderID).Error; err != nil {
+			break
+		}
+		root = &parent
+	}
+	return root
+}
+
+// countRechecks counts the re-checks built on root, directly or through
+// other re-checks, stopping once limit is reached
+func countRechecks(db *gorm.DB, rootID uint, limit int) int {
+	count := 0
+	frontier := []uint{rootID}
+	for len(frontier) > 0 && count < limit {
+		var children []uint
+		db.Unscoped().Model(&models.Order{}).Where("previous_order_id IN ?", frontier).Pluck("id", &children)
+		count += len(children)
+		frontier = children
+	}
+	return count
+}
+
+// recheckCost is the slot price of re-checking a revised document. Within
+// RECHECK_WINDOW_HOURS of the first version it costs RECHECK_COST_SLOTS
+// (default the normal single slot, set 0 for free re-checks). A document can
+// be re-checked at most RECHECK_MAX times.
+func recheckCost(db *gorm.DB, previous *models.Order) (int, error) {
+	root := rootVersion(db, previous)
+	if max := envInt("RECHECK_MAX", 5); countRechecks(db, root.ID, max) >= max {
+		return 0, fmt.Errorf("this document has reached the limit of %d re-checks, upload it as a new order instead", max)
+	}
+
+	window := time.Duration(envInt("RECHECK_WINDOW_HOURS", 72)) * time.Hour
+	if time.Since(root.CreatedAt) > window {
+		return 1, nil
+	}
+	cost := envInt("RECHECK_COST_SLOTS", 1)
+	if cost < 0 {
+		return 0, nil
+	}
+	return cost, nil
+}
+
+// flaggedPassages collects every flagged passage across an order's reports,
+// keyed by a normalised form so small whitespace/case edits still match
+func flaggedPassages(reports []models.Report) (map[string]string, []string) {
+	passages := make(map[string]string)
+	var keys []string
+	add := func(text string) {
+		key := strings.ToLower(strings.Join(strings.Fields(text), " "))
+		if key == "" {
+			return
+		}
+		if _, seen := passages[key]; !seen {
+			passages[key] = text
+			keys = append(keys, key)
+		}
+	}
+	for _, report := range reports {
+		for _, source := range report.MatchedSources {
+			for _, passage := range source.Passages {
+				add(passage)
+			}
+		}
+		for _, section := range report.Sections {
+			for _, passage := range section.Passages {
+				add(passage)
+			}
+		}
+	}
+	return passages, keys
+}
+
+// matchedSourceNames lists the distinct sources cited by the similarity report
+func matchedSourceNames(reports []models.Report) map[string]bool {
+	names := make(map[string]bool)
+	for _, report := range reports {
+		for _, source := range report.MatchedSources {
+			names[source.Source] = true
+		}
+	}
+	return names
+}
+
+// CompareRevision diffs a re-checked order against the version it revised
+// (or ?against=<order id>): score changes, and which flagged passages were
+// removed, remain, or are new.
+func (h *OrderHandler) CompareRevision(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	userIDUint := uint(userID.(float64))
+
+	// Either version may already have been soft-deleted by the cleanup job
+	var current models.Order
+	if err := h.DB.Unscoped().Preload("Reports").First(&current, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if current.UserID != userIDUint {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	againstID := c.Query("against")
+	if againstID == "" {
+		if current.PreviousOrderID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This order is not a re-check of an earlier version"})
+			return
+		}
+		againstID = fmt.Sprint(*current.PreviousOrderID)
+	}
+
+	var previous models.Order
+	if err := h.DB.Unscoped().Preload("Reports").First(&previous, againstID).Error; err != nil || previous.UserID != userIDUint {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Previous version not found"})
+		return
+	}
+
+	if current.Status != models.StatusCompleted || previous.Status != models.StatusCompleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Both versions must be completed before they can be compared"})
+		return
+	}
+
+	scoreChange := func(before, after int) gin.H {
+		return gin.H{"before": before, "after": after, "change": after - before}
+	}
+
+	beforePassages, beforeKeys := flaggedPassages(previous.Reports)
+	afterPassages, afterKeys := flaggedPassages(current.Reports)
+	removed, remaining, added := []string{}, []string{}, []string{}
+	for _, key := range beforeKeys {
+		if _, ok := afterPassages[key]; ok {
+			remaining = append(remaining, afterPassages[key])
+		} else {
+			removed = append(removed, beforePassages[key])
+		}
+	}
+	for _, key := range afterKeys {
+		if _, ok := beforePassages[key]; !ok {
+			added = append(added, afterPassages[key])
+		}
+	}
+
+	beforeSources := matchedSourceNames(previous.Reports)
+	afterSources := matchedSourceNames(current.Reports)
+	droppedSources, newSources := []string{}, []string{}
+	for name := range beforeSources {
+		if !afterSources[name] {
+			droppedSources = append(droppedSources, name)
+		}
+	}
+	for name := range afterSources {
+		if !beforeSources[name] {
+			newSources = append(newSources, name)
+		}
+	}
+	sort.Strings(droppedSources)
+	sort.Strings(newSources)
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_id":          current.ID,
+		"previous_order_id": previous.ID,
+		"version":           current.Version,
+		"previous_version":  previous.Version,
+		"scores": gin.H{
+			"ai":         scoreChange(previous.AIScore, current.AIScore),
+			"similarity": scoreChange(previous.SimScore, current.SimScore),
+		},
+		"passages": gin.H{
+			"removed":   removed,
+			"remaining": remaining,
+			"new":       added,
+		},
+		"sources": gin.H{
+			"removed": droppedSources,
+			"new":     newSources,
+		},
+	})
+}
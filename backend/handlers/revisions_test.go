@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"checkmate-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// recheckChain stores a first version created at created and n re-checks
+// chained onto it, returning the newest
+func recheckChain(t *testing.T, db *gorm.DB, created time.Time, n int) *models.Order {
+	t.Helper()
+	order := models.Order{UserID: 1, Status: models.StatusCompleted, Version: 1}
+	order.CreatedAt = created
+	db.Create(&order)
+	for i := 0; i < n; i++ {
+		next := models.Order{UserID: 1, Status: models.StatusCompleted, Version: order.Version + 1, PreviousOrderID: &order.ID}
+		db.Create(&next)
+		order = next
+	}
+	return &order
+}
+
+func TestRecheckWindowRunsFromFirstVersion(t *testing.T) {
+	t.Setenv("RECHECK_COST_SLOTS", "0")
+	t.Setenv("RECHECK_WINDOW_HOURS", "72")
+	db := newTestDB(t)
+
+	// The latest version is new, but the document was first checked long ago
+	latest := recheckChain(t, db, time.Now().Add(-30*24*time.Hour), 2)
+	cost, err := recheckCost(db, latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost != 1 {
+		t.Fatalf("cost = %d, want the full price of 1", cost)
+	}
+
+	fresh := recheckChain(t, db, time.Now(), 2)
+	if cost, _ := recheckCost(db, fresh); cost != 0 {
+		t.Fatalf("cost = %d, want 0 within the window", cost)
+	}
+}
+
+func TestRechecksAreCappedPerDocument(t *testing.T) {
+	t.Setenv("RECHECK_MAX", "3")
+	db := newTestDB(t)
+
+	latest := recheckChain(t, db, time.Now(), 2)
+	if _, err := recheckCost(db, latest); err != nil {
+		t.Fatalf("third re-check rejected: %v", err)
+	}
+
+	// Branching off an earlier version still counts against the same document
+	var first models.Order
+	db.First(&first, "version = 1")
+	db.Create(&models.Order{UserID: 1, Status: models.StatusCompleted, Version: 2, PreviousOrderID: &first.ID})
+	if _, err := recheckCost(db, latest); err == nil {
+		t.Fatal("fourth re-check was allowed")
+	}
+	if _, err := recheckCost(db, &first); err == nil {
+		t.Fatal("re-check of the first version was allowed past the limit")
+	}
+}
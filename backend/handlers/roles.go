@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const roleSuperadmin = "superadmin"
+
+// builtInRoles are (re)seeded at startup so new permissions reach existing installs
+var builtInRoles = []models.Role{
+	{Name: roleSuperadmin, Description: "Full access, including managing staff roles", Permissions: []string{models.PermAll}},
+	{Name: "finance", Description: "Payments, pricing packages and customer balances", Permissions: []string{
+		models.PermTransactionsView, models.PermTransactionsVerify, models.PermPackagesManage,
+		models.PermUsersView, models.PermCreditsGrant, models.PermNotifications,
+	}},
+	{Name: "operator", Description: "Processes orders from the queue", Permissions: []string{
+		models.PermOrdersView, models.PermOrdersProcess, models.PermOrdersMessage, models.PermNotifications,
+	}},
+	{Name: "support", Description: "Answers customers about their orders", Permissions: []string{
+		models.PermOrdersView, models.PermOrdersMessage, models.PermUsersView, models.PermUsersManage, models.PermUsersImpersonate, models.PermNotifications,
+	}},
+}
+
+// SeedRoles creates the built-in roles and gives pre-RBAC admins the superadmin role
+func SeedRoles(db *gorm.DB) {
+	for _, builtIn := range builtInRoles {
+		var role models.Role
+		if err := db.Where("name = ?", builtIn.Name).First(&role).Error; err != nil {
+			role = builtIn
+			role.BuiltIn = true
+			db.Create(&role)
+			continue
+		}
+		role.Description = builtIn.Description
+		role.Permissions = builtIn.Permissions
+		role.BuiltIn = true
+		db.Save(&role)
+	}
+
+	var legacyAdmins []models.User
+	db.Where("is_admin = ? AND id NOT IN (SELECT user_id FROM user_roles)", true).Find(&legacyAdmins)
+	for _, user := range legacyAdmins {
+		if err := grantSuperadmin(db, &user); err != nil {
+			log.Println("Failed to migrate admin to superadmin role:", err)
+		}
+	}
+}
+
+// grantSuperadmin adds the superadmin role to a user
+func grantSuperadmin(db *gorm.DB, user *models.User) error {
+	var role models.Role
+	if err := db.Where("name = ?", roleSuperadmin).First(&role).Error; err != nil {
+		return err
+	}
+	if err := db.Model(user).Association("Roles").Append(&role); err != nil {
+		return err
+	}
+	return db.Model(user).Update("is_admin", true).Error
+}
+
+// PromoteAdminEmail makes the ADMIN_EMAIL account a superadmin if it isn't
+// already. The address must be verified, or anyone could sign up with it.
+func PromoteAdminEmail(db *gorm.DB, email string) bool {
+	if email == "" {
+		return false
+	}
+	var user models.User
+	if err := whereEmail(db.Preload("Roles"), email).Where("email_verified = ?", true).First(&user).Error; err != nil {
+		return false
+	}
+	if user.HasPermission(models.PermAll) {
+		return false
+	}
+	return grantSuperadmin(db, &user) == nil
+}
+
+// userCan loads the user's roles and checks a single permission
+func userCan(db *gorm.DB, userID interface{}, permission string) bool {
+	var user models.User
+	if err := db.Preload("Roles").First(&user, userID).Error; err != nil {
+		return false
+	}
+	return user.HasPermission(permission)
+}
+
+// validPermissions rejects names that aren't in models.AllPermissions
+func validPermissions(permissions []string) bool {
+	for _, permission := range permissions {
+		valid := permission == models.PermAll
+		for _, known := range models.AllPermissions {
+			if permission == known {
+				valid = true
+			}
+		}
+		if !valid {
+			return false
+		}
+	}
+	return true
+}
+
+// callerHolds reports whether the signed-in staff member has every one of
+// the permissions, so role managers can't grant (or take away) more access
+// than they have themselves. Only superadmins hold "*".
+func callerHolds(c *gin.Context, db *gorm.DB, permissions []string) bool {
+	userID, _ := c.Get("userID")
+	var caller models.User
+	if err := db.Preload("Roles").First(&caller, userID).Error; err != nil {
+		return false
+	}
+	for _, permission := range permissions {
+		if !caller.HasPermission(permission) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasRole(roles []models.Role, id uint) bool {
+	for _, role := range roles {
+		if role.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// rolePermissions lists the permissions granted by a set of roles
+func rolePermissions(roles []models.Role) []string {
+	permissions := []string{}
+	for _, role := range roles {
+		permissions = append(permissions, role.Permissions...)
+	}
+	return permissions
+}
+
+const msgGrantBeyondOwn = "You can't grant or remove permissions you don't hold"
+
+type RoleHandler struct {
+	DB *gorm.DB
+}
+
+func NewRoleHandler(db *gorm.DB) *RoleHandler {
+	return &RoleHandler{DB: db}
+}
+
+// AdminListRoles returns every role and the permissions that can be granted
+func (h *RoleHandler) AdminListRoles(c *gin.Context) {
+	var roles []models.Role
+	h.DB.Order("built_in desc, name asc").Find(&roles)
+	c.JSON(http.StatusOK, gin.H{"roles": roles, "permissions": models.AllPermissions})
+}
+
+// AdminCreateRole adds a custom role
+func (h *RoleHandler) AdminCreateRole(c *gin.Context) {
+	var body struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body.Name = strings.ToLower(strings.TrimSpace(body.Name))
+	if body.Name == "" || !validPermissions(body.Permissions) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A name and valid permissions are required"})
+		return
+	}
+	if !callerHolds(c, h.DB, body.Permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": msgGrantBeyondOwn})
+		return
+	}
+
+	role := models.Role{Name: body.Name, Description: body.Description, Permissions: body.Permissions}
+	if err := h.DB.Create(&role).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A role with that name already exists"})
+		return
+	}
+	recordAuditChange(c, h.DB, "role.create", "role", role.ID, nil, role, nil)
+	c.JSON(http.StatusOK, role)
+}
+
+// AdminUpdateRole changes a custom role's description or permissions
+func (h *RoleHandler) AdminUpdateRole(c *gin.Context) {
+	var role models.Role
+	if err := h.DB.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if role.BuiltIn {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles cannot be changed"})
+		return
+	}
+
+	before := role
+	var body struct {
+		Description *string  `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Description != nil {
+		role.Description = *body.Description
+	}
+	if body.Permissions != nil {
+		if !validPermissions(body.Permissions) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission"})
+			return
+		}
+		role.Permissions = body.Permissions
+	}
+	if !callerHolds(c, h.DB, append(append([]string{}, before.Permissions...), role.Permissions...)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": msgGrantBeyondOwn})
+		return
+	}
+
+	if err := h.DB.Save(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	recordAuditChange(c, h.DB, "role.update", "role", role.ID, before, role, nil)
+	c.JSON(http.StatusOK, role)
+}
+
+// AdminDeleteRole removes a custom role from everyone who holds it
+func (h *RoleHandler) AdminDeleteRole(c *gin.Context) {
+	var role models.Role
+	if err := h.DB.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if role.BuiltIn {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles cannot be deleted"})
+		return
+	}
+	if !callerHolds(c, h.DB, role.Permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": msgGrantBeyondOwn})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", role.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&role).Error; err != nil {
+			return err
+		}
+		// Users left without any role lose admin panel access
+		return tx.Model(&models.User{}).
+			Where("is_admin = ? AND id NOT IN (SELECT user_id FROM user_roles)", true).
+			Update("is_admin", false).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	recordAuditChange(c, h.DB, "role.delete", "role", role.ID, role, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
+
+// AdminSetUserRoles replaces a user's roles. An empty list removes staff access.
+func (h *RoleHandler) AdminSetUserRoles(c *gin.Context) {
+	var body struct {
+		Roles []string `json:"roles"` // Role names
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.Preload("Roles").First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// A name listed twice is still one role
+	names := []string{}
+	seen := map[string]bool{}
+	for _, name := range body.Roles {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	roles := []models.Role{}
+	if len(names) > 0 {
+		h.DB.Where("name IN ?", names).Find(&roles)
+		if len(roles) != len(names) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+			return
+		}
+	}
+
+	// Roles being added or taken away must not carry more access than the
+	// caller has, or a role manager could make themselves (or anyone) superadmin
+	changed := []models.Role{}
+	for _, role := range roles {
+		if !hasRole(user.Roles, role.ID) {
+			changed = append(changed, role)
+		}
+	}
+	for _, role := range user.Roles {
+		if !hasRole(roles, role.ID) {
+			changed = append(changed, role)
+		}
+	}
+	if !callerHolds(c, h.DB, rolePermissions(changed)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": msgGrantBeyondOwn})
+		return
+	}
+
+	// Never leave the platform without someone who can manage roles
+	keepsSuperadmin := false
+	for _, role := range roles {
+		if role.Name == roleSuperadmin {
+			keepsSuperadmin = true
+		}
+	}
+	if user.HasPermission(models.PermAll) && !keepsSuperadmin {
+		var others int64
+		h.DB.Table("user_roles").
+			Joins("JOIN roles ON roles.id = user_roles.role_id").
+			Joins("JOIN users ON users.id = user_roles.user_id AND users.deleted_at IS NULL").
+			Where("roles.name = ? AND user_roles.user_id <> ?", roleSuperadmin, user.ID).
+			Count(&others)
+		if others == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot remove the last superadmin"})
+			return
+		}
+	}
+
+	// Replace overwrites user.Roles, so note the old names first
+	before := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		before = append(before, role.Name)
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Association("Roles").Replace(roles); err != nil {
+			return err
+		}
+		return tx.Model(&user).Update("is_admin", len(roles) > 0).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update roles"})
+		return
+	}
+
+	after := make([]string, 0, len(roles))
+	for _, role := range roles {
+		after = append(after, role.Name)
+	}
+	recordAuditChange(c, h.DB, "user.roles", "user", user.ID, gin.H{"roles": before}, gin.H{"roles": after}, nil)
+
+	user.Roles = roles
+	c.JSON(http.StatusOK, gin.H{"id": user.ID, "email": user.Email, "is_admin": len(roles) > 0, "roles": roles})
+}
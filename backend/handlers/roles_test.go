@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"checkmate-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// staffWithRole stores a user holding the named built-in role
+func staffWithRole(t *testing.T, db *gorm.DB, email, roleName string) models.User {
+	t.Helper()
+	var role models.Role
+	if err := db.First(&role, "name = ?", roleName).Error; err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Email: email, Roles: []models.Role{role}}
+	db.Create(&user)
+	return user
+}
+
+func setRoles(t *testing.T, db *gorm.DB, callerID, targetID uint, body string) int {
+	t.Helper()
+	r := gin.New()
+	r.PUT("/users/:id/roles", signedInAs(callerID), NewRoleHandler(db).AdminSetUserRoles)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/users/%d/roles", targetID), bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestSetRolesAcceptsRepeatedNames(t *testing.T) {
+	db := newTestDB(t)
+	SeedRoles(db)
+	admin := staffWithRole(t, db, "admin@example.com", roleSuperadmin)
+	target := models.User{Email: "staff@example.com"}
+	db.Create(&target)
+
+	if code := setRoles(t, db, admin.ID, target.ID, `{"roles":["support","support"]}`); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	var user models.User
+	db.Preload("Roles").First(&user, target.ID)
+	if len(user.Roles) != 1 || user.Roles[0].Name != "support" {
+		t.Fatalf("roles = %v, want just support", user.Roles)
+	}
+}
+
+func TestSetRolesCannotGrantBeyondCaller(t *testing.T) {
+	db := newTestDB(t)
+	SeedRoles(db)
+	support := staffWithRole(t, db, "support@example.com", "support")
+	target := models.User{Email: "staff@example.com"}
+	db.Create(&target)
+
+	if code := setRoles(t, db, support.ID, target.ID, `{"roles":["finance"]}`); code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", code)
+	}
+	if code := setRoles(t, db, support.ID, target.ID, `{"roles":["nonexistent"]}`); code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400 for an unknown role", code)
+	}
+}
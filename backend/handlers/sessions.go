@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// describeDevice turns a User-Agent into a short label such as "Chrome on Windows"
+func describeDevice(userAgent string) string {
+	browser := ""
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	}
+
+	platform := ""
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		platform = "Android"
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		platform = "iOS"
+	case strings.Contains(userAgent, "Windows"):
+		platform = "Windows"
+	case strings.Contains(userAgent, "Mac OS X"):
+		platform = "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		platform = "Linux"
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+	return "Unknown device"
+}
+
+// startSession records a new login for the requesting device
+func startSession(c *gin.Context, db *gorm.DB, userID uint) (*models.Session, error) {
+	userAgent := c.GetHeader("User-Agent")
+	session := models.Session{
+		UserID:     userID,
+		Device:     describeDevice(userAgent),
+		IP:         c.ClientIP(),
+		UserAgent:  userAgent,
+		LastSeenAt: time.Now(),
+		ExpiresAt:  time.Now().Add(refreshTokenTTL()),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// revokeSession signs one session out, along with its refresh tokens
+func revokeSession(db *gorm.DB, sessionID uint) {
+	now := time.Now()
+	db.Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", sessionID).Update("revoked_at", now)
+	db.Model(&models.RefreshToken{}).Where("session_id = ? AND revoked_at IS NULL", sessionID).Update("revoked_at", now)
+}
+
+// revokeUserSessions signs a user out everywhere
+func revokeUserSessions(db *gorm.DB, userID uint) {
+	now := time.Now()
+	db.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now)
+	db.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now)
+}
+
+// revokeOtherSessions signs a user out everywhere except the current session
+func revokeOtherSessions(db *gorm.DB, userID, currentSessionID uint) {
+	now := time.Now()
+	db.Model(&models.Session{}).Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, currentSessionID).Update("revoked_at", now)
+	db.Model(&models.RefreshToken{}).Where("user_id = ? AND session_id <> ? AND revoked_at IS NULL", userID, currentSessionID).Update("revoked_at", now)
+}
+
+// ListSessions returns the user's active sessions, flagging the one making the request
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	currentID, _ := c.Get("sessionID")
+
+	var sessions []models.Session
+	h.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at desc").
+		Find(&sessions)
+
+	result := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, gin.H{
+			"id":           session.ID,
+			"device":       session.Device,
+			"ip":           session.IP,
+			"user_agent":   session.UserAgent,
+			"last_seen_at": session.LastSeenAt,
+			"created_at":   session.CreatedAt,
+			"current":      session.ID == currentID,
+		})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// RevokeSession signs out one of the user's sessions (e.g. a lost device)
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var session models.Session
+	if err := h.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	revokeSession(h.DB, session.ID)
+	recordAudit(c, h.DB, "user.session_revoke", "user", session.UserID, gin.H{"session_id": session.ID, "device": session.Device})
+	c.JSON(http.StatusOK, gin.H{"message": "Session signed out"})
+}
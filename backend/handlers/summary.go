@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// newVerificationCode returns a random code such as "CM-7K3Q-X9PA-M2TD".
+// The alphabet skips look-alike characters (0/O, 1/I) so codes can be typed.
+func newVerificationCode() (string, error) {
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	raw := make([]byte, 12)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	var code strings.Builder
+	code.WriteString("CM")
+	for i, b := range raw {
+		if i%4 == 0 {
+			code.WriteByte('-')
+		}
+		code.WriteByte(alphabet[int(b)%len(alphabet)])
+	}
+	return code.String(), nil
+}
+
+// writeSummaryPDF renders the branded summary certificate for a completed
+// order into uploads/ and returns the stored filename
+func writeSummaryPDF(order *models.Order, reports []*models.Report) (string, error) {
+	page := &pdfPage{}
+
+	// Header band
+	page.fill(13, 148, 136)
+	page.rect(0, 0, pdfPageWidth, 110)
+	page.fill(255, 255, 255)
+	page.text(50, 55, 26, true, "Checkmate")
+	page.text(50, 82, 12, false, "Document Verification Summary")
+
+	// Details table. Nothing may run into the verification box, so anything
+	// that doesn't fit above it is left to the full reports.
+	boxY := pdfPageHeight - 190
+	bottom := boxY - 30
+	y := 160.0
+	omitted := false
+	row := func(label, value string) {
+		if y+12 > bottom {
+			omitted = true
+			return
+		}
+		page.fill(100, 116, 139)
+		page.text(50, y, 10, false, pdfFit(label, 10, 140))
+		page.fill(15, 23, 42)
+		page.text(200, y, 11, true, pdfFit(value, 11, pdfPageWidth-250))
+		page.rule(50, pdfPageWidth-50, y+12)
+		y += 32
+	}
+
+	completedAt := time.Now()
+	if order.CompletedAt != nil {
+		completedAt = *order.CompletedAt
+	}
+	wordCount := "Not available"
+	if order.WordCount > 0 {
+		wordCount = fmt.Sprintf("%d", order.WordCount)
+	}
+
+	row("Document", order.OriginalFilename)
+	row("Word count", wordCount)
+	row("AI score", fmt.Sprintf("%d%%", order.AIScore))
+	row("Similarity score", fmt.Sprintf("%d%%", order.SimScore))
+	row("Submitted", order.CreatedAt.UTC().Format("02 Jan 2006 15:04 MST"))
+	row("Completed", completedAt.UTC().Format("02 Jan 2006 15:04 MST"))
+
+	// Any further structured findings (other report types, top sources)
+	for _, report := range reports {
+		if report.Type == models.ReportAI || report.Type == models.ReportSimilarity || report.Type == models.ReportSummary {
+			continue
+		}
+		if report.Score != nil {
+			row(strings.ToUpper(string(report.Type[:1]))+string(report.Type[1:])+" score", fmt.Sprintf("%d%%", *report.Score))
+		}
+	}
+	for _, report := range reports {
+		if report.Type != models.ReportSimilarity || len(report.MatchedSources) == 0 {
+			continue
+		}
+		if y+10+24 > bottom {
+			omitted = true
+			break
+		}
+		y += 10
+		page.fill(15, 23, 42)
+		page.text(50, y, 12, true, "Top matched sources")
+		y += 24
+		for i, source := range report.MatchedSources {
+			if i == 5 {
+				break
+			}
+			if y > bottom {
+				omitted = true
+				break
+			}
+			page.fill(51, 65, 85)
+			page.text(60, y, 10, false, pdfFit(fmt.Sprintf("%d%%  %s", source.Similarity, source.Source), 10, pdfPageWidth-110))
+			y += 18
+		}
+	}
+	if omitted {
+		page.fill(100, 116, 139)
+		page.text(50, boxY-12, 9, false, "Further findings are listed in the full reports.")
+	}
+
+	// Verification box
+	code := ""
+	if order.VerificationCode != nil {
+		code = *order.VerificationCode
+	}
+	page.fill(240, 253, 250)
+	page.rect(50, boxY, pdfPageWidth-100, 80)
+	page.fill(15, 118, 110)
+	page.text(70, boxY+30, 10, false, "Verification code")
+	page.text(70, boxY+58, 20, true, code)
+	page.fill(51, 65, 85)
+	page.text(50, boxY+100, 9, false, "Confirm this report is genuine at "+appURL()+"/verify/"+code)
+
+	// Footer
+	page.fill(100, 116, 139)
+	page.text(50, pdfPageHeight-50, 8, false, fmt.Sprintf("Order #%d - generated %s", order.ID, time.Now().UTC().Format(time.RFC1123)))
+
+	filename := fmt.Sprintf("report_%d_%d_summary.pdf", order.ID, time.Now().Unix())
+	if err := os.WriteFile(filepath.Join("./uploads", filename), page.bytes(), 0644); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
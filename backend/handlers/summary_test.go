@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"checkmate-backend/models"
+)
+
+var pdfTextOp = regexp.MustCompile(`([\d.]+) ([\d.]+) Td \((.*?)\) Tj`)
+
+func TestSummaryFindingsStayAboveVerificationBox(t *testing.T) {
+	inTempDir(t)
+	code := "CM-TEST-CODE-0001"
+	order := &models.Order{ID: 7, OriginalFilename: strings.Repeat("very long file name ", 20) + ".docx", VerificationCode: &code}
+
+	var reports []*models.Report
+	for i := 0; i < 30; i++ {
+		score := i
+		reports = append(reports, &models.Report{Type: models.ReportType(fmt.Sprintf("extra%d", i)), Score: &score})
+	}
+	sources := make([]models.MatchedSource, 5)
+	for i := range sources {
+		sources[i] = models.MatchedSource{Source: strings.Repeat("https://example.com/a/long/path ", 10), Similarity: 10}
+	}
+	reports = append(reports, &models.Report{Type: models.ReportSimilarity, MatchedSources: sources})
+
+	filename, err := writeSummaryPDF(order, reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join("uploads", filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	boxTop := pdfPageHeight - 190
+	noteShown := false
+	for _, op := range pdfTextOp.FindAllStringSubmatch(string(data), -1) {
+		x, _ := strconv.ParseFloat(op[1], 64)
+		y, _ := strconv.ParseFloat(op[2], 64)
+		text := op[3]
+		top := pdfPageHeight - y
+		if strings.HasPrefix(text, "Further findings") {
+			noteShown = true
+			continue
+		}
+		if top < boxTop-20 && top > 110 && x+float64(len(text))*6.6 > pdfPageWidth {
+			t.Errorf("%q runs off the page", text)
+		}
+		if top > boxTop-30 && top < boxTop+90 && text != "Verification code" && text != code {
+			t.Errorf("%q is drawn over the verification box (y=%.0f)", text, top)
+		}
+	}
+	if !noteShown {
+		t.Error("findings were dropped without saying so")
+	}
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// accessTokenTTL is the lifetime of the JWT sent with every request
+func accessTokenTTL() time.Duration {
+	return time.Duration(envInt("ACCESS_TOKEN_TTL_MINUTES", 15)) * time.Minute
+}
+
+// refreshTokenTTL is how long a login lasts without activity
+func refreshTokenTTL() time.Duration {
+	return time.Duration(envInt("REFRESH_TOKEN_TTL_DAYS", 30)) * 24 * time.Hour
+}
+
+// hashToken returns the SHA-256 hex digest stored in place of an opaque token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomToken returns a random hex string with n bytes of entropy
+func randomToken(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// issueAccessToken signs a short-lived HS256 JWT for the user, bound to a session
+func issueAccessToken(user models.User, sessionID uint) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   user.ID,
+		"sid":   sessionID,
+		"email": user.Email,
+		"admin": user.IsAdmin,
+		"exp":   time.Now().Add(accessTokenTTL()).Unix(),
+	})
+	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+// issueRefreshToken stores a new refresh token for the session and returns
+// the raw token (only its hash is kept server-side)
+func issueRefreshToken(db *gorm.DB, session *models.Session) (string, *models.RefreshToken, error) {
+	raw, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	record := models.RefreshToken{
+		UserID:    session.UserID,
+		SessionID: session.ID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: time.Now().Add(refreshTokenTTL()),
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return "", nil, err
+	}
+	return raw, &record, nil
+}
+
+// respondWithTokens finishes a successful login: it opens a session for this
+// device and returns an access/refresh token pair for it
+func respondWithTokens(c *gin.Context, db *gorm.DB, user models.User) {
+	// Reload so the response reflects any role just granted
+	if err := db.Preload("Roles").First(&user, user.ID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if rejectIfSuspended(c, &user) {
+		return
+	}
+	resetLoginFailures(db, &user)
+
+	session, err := startSession(c, db, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	accessToken, err := issueAccessToken(user, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	refreshToken, _, err := issueRefreshToken(db, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	recordSecurityEvent(c, db, user.ID, "auth.login", gin.H{"session_id": session.ID, "via": c.Request.URL.Path})
+	writeTokens(c, user, accessToken, refreshToken)
+}
+
+// writeTokens sends the token pair and the user summary the frontend stores
+// (Roles must be preloaded for the permission list)
+func writeTokens(c *gin.Context, user models.User, accessToken, refreshToken string) {
+	c.JSON(http.StatusOK, gin.H{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(accessTokenTTL().Seconds()),
+		"user": gin.H{
+			"id":             user.ID,
+			"email":          user.Email,
+			"email_verified": user.EmailVerified,
+			"is_admin":       user.IsAdmin,
+			"permissions":    user.Permissions(),
+		},
+	})
+}
+
+// Refresh rotates a refresh token: the old one is revoked and a new pair issued.
+// Presenting an already-rotated token means it was stolen or replayed, so the
+// whole session is revoked and the user has to log in again.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if c.BindJSON(&body) != nil || body.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token required"})
+		return
+	}
+
+	var current models.RefreshToken
+	if err := h.DB.Where("token_hash = ?", hashToken(body.RefreshToken)).First(&current).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	if current.RevokedAt != nil {
+		// A rotated token coming back while its session is live suggests theft
+		var replayed models.Session
+		if h.DB.First(&replayed, current.SessionID).Error == nil && replayed.RevokedAt == nil {
+			recordSecurityEvent(c, h.DB, current.UserID, "auth.refresh_reuse", gin.H{"session_id": current.SessionID})
+		}
+		revokeSession(h.DB, current.SessionID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token already used. Please log in again."})
+		return
+	}
+	if time.Now().After(current.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired. Please log in again."})
+		return
+	}
+
+	var session models.Session
+	if err := h.DB.First(&session, current.SessionID).Error; err != nil || session.RevokedAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been signed out. Please log in again."})
+		return
+	}
+
+	// Re-read the user so role changes apply on the next access token
+	var user models.User
+	if err := h.DB.Preload("Roles").First(&user, current.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if rejectIfSuspended(c, &user) {
+		revokeSession(h.DB, session.ID)
+		return
+	}
+
+	var refreshToken string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Only one concurrent refresh may win the rotation
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		raw, next, err := issueRefreshToken(tx, &session)
+		if err != nil {
+			return err
+		}
+		refreshToken = raw
+		if err := tx.Model(&current).Update("replaced_by_id", next.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"last_seen_at": time.Now(),
+			"ip":           c.ClientIP(),
+			"expires_at":   next.ExpiresAt,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	accessToken, err := issueAccessToken(user, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	writeTokens(c, user, accessToken, refreshToken)
+}
+
+// Logout ends the session the presented refresh token belongs to
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if c.BindJSON(&body) != nil || body.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token required"})
+		return
+	}
+
+	var current models.RefreshToken
+	if err := h.DB.Where("token_hash = ?", hashToken(body.RefreshToken)).First(&current).Error; err == nil {
+		revokeSession(h.DB, current.SessionID)
+	}
+
+	// Same answer either way so tokens can't be probed
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// LogoutAll ends every session the user has, including the current one
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	revokeUserSessions(h.DB, uint(userID.(float64)))
+	recordAudit(c, h.DB, "user.logout_all", "user", uint(userID.(float64)), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions"})
+}
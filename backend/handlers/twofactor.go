@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"checkmate-backend/middleware"
+	"checkmate-backend/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	totpPeriod         = 30 // seconds per code
+	totpDigits         = 6
+	recoveryCodeCount  = 10
+	twoFactorChallenge = "2fa"
+)
+
+// newTOTPSecret returns a random 160-bit base32 secret (the RFC 4226 recommended size)
+func newTOTPSecret() (string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw), nil
+}
+
+// totpCode computes the RFC 6238 code for a time step
+func totpCode(secret string, step int64) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// matchTOTP checks a code against the current step and one step either side
+// (clock drift), returning the matching step. Steps at or before lastStep are
+// refused so an observed code can't be replayed.
+func matchTOTP(secret, code string, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	now := time.Now().Unix() / totpPeriod
+	for _, step := range []int64{now - 1, now, now + 1} {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totpCode(secret, step)
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// provisioningURI is the otpauth:// link authenticator apps read from a QR code
+func provisioningURI(email, secret string) string {
+	label := url.PathEscape("Checkmate:" + email)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", "Checkmate")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// newRecoveryCodes replaces a user's recovery codes and returns the new plaintext set
+func newRecoveryCodes(db *gorm.DB, userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := randomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{UserID: userID, CodeHash: hashToken(code)})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+	return codes, err
+}
+
+// useRecoveryCode consumes a matching unused recovery code
+func useRecoveryCode(db *gorm.DB, userID uint, code string) bool {
+	code = strings.ToLower(strings.TrimSpace(code))
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(code)).
+		Update("used_at", time.Now())
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code
+func verifySecondFactor(db *gorm.DB, user *models.User, code string) bool {
+	if step, ok := matchTOTP(user.TOTPSecret, code, user.TOTPLastStep); ok {
+		// Conditional so two concurrent logins can't both use the same code
+		result := db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		return result.Error == nil && result.RowsAffected == 1
+	}
+	return useRecoveryCode(db, user.ID, code)
+}
+
+// completeLogin issues tokens, or a short-lived 2FA challenge when the user
+// has a second factor enabled
+func completeLogin(c *gin.Context, db *gorm.DB, user models.User) {
+	if rejectIfSuspended(c, &user) {
+		return
+	}
+	if !user.TOTPEnabled {
+		respondWithTokens(c, db, user)
+		return
+	}
+
+	challenge := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": user.ID,
+		"typ": twoFactorChallenge,
+		"exp": time.Now().Add(5 * time.Minute).Unix(),
+	})
+	challengeString, err := challenge.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"two_factor_required": true,
+		"challenge":           challengeString,
+	})
+}
+
+// LoginTwoFactor finishes a login that returned a 2FA challenge
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var body struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+	if c.BindJSON(&body) != nil || body.Challenge == "" || body.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Challenge and code are required"})
+		return
+	}
+
+	token, err := jwt.Parse(body.Challenge, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+	if err != nil || !token.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired. Please sign in again."})
+		return
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != twoFactorChallenge {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired. Please sign in again."})
+		return
+	}
+
+	sub, _ := claims["sub"].(float64)
+	var user models.User
+	if err := h.DB.First(&user, uint(sub)).Error; err != nil || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired. Please sign in again."})
+		return
+	}
+
+	if rejectIfLocked(c, &user) {
+		return
+	}
+	if !verifySecondFactor(h.DB, &user, body.Code) {
+		recordLoginFailure(c, h.DB, &user)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	respondWithTokens(c, h.DB, user)
+}
+
+// TwoFactorStatus reports whether 2FA is on, and whether the account must enable it
+func (h *AuthHandler) TwoFactorStatus(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var remaining int64
+	h.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  user.TOTPEnabled,
+		"required":                 user.IsAdmin && middleware.Staff2FARequired(),
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupTwoFactor starts enrollment: it stores a new pending secret and returns
+// the provisioning URI to show as a QR code
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create secret"})
+		return
+	}
+	h.DB.Model(&user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0})
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": provisioningURI(user.Email, secret),
+	})
+}
+
+// EnableTwoFactor confirms enrollment with a code from the app and returns
+// recovery codes (shown once)
+func (h *AuthHandler) EnableTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var body struct {
+		Code string `json:"code"`
+	}
+	if c.BindJSON(&body) != nil || body.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start setup first"})
+		return
+	}
+
+	step, ok := matchTOTP(user.TOTPSecret, body.Code, 0)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	codes, err := newRecoveryCodes(h.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recovery codes"})
+		return
+	}
+	h.DB.Model(&user).Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step})
+	recordAuditChange(c, h.DB, "user.2fa_enable", "user", user.ID, gin.H{"totp_enabled": false}, gin.H{"totp_enabled": true}, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns 2FA off after checking a current code
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var body struct {
+		Code string `json:"code"`
+	}
+	if c.BindJSON(&body) != nil || body.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if user.IsAdmin && middleware.Staff2FARequired() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for staff accounts"})
+		return
+	}
+	if rejectIfLocked(c, &user) {
+		return
+	}
+	if !verifySecondFactor(h.DB, &user, body.Code) {
+		recordLoginFailure(c, h.DB, &user)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	h.DB.Model(&user).Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0})
+	h.DB.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{})
+	recordAuditChange(c, h.DB, "user.2fa_disable", "user", user.ID, gin.H{"totp_enabled": true}, gin.H{"totp_enabled": false}, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a current code
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var body struct {
+		Code string `json:"code"`
+	}
+	if c.BindJSON(&body) != nil || body.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil || !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if rejectIfLocked(c, &user) {
+		return
+	}
+	if !verifySecondFactor(h.DB, &user, body.Code) {
+		recordLoginFailure(c, h.DB, &user)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	codes, err := newRecoveryCodes(h.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recovery codes"})
+		return
+	}
+	recordAudit(c, h.DB, "user.recovery_codes", "user", user.ID, nil)
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"checkmate-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWrongCodesLockTwoFactorChanges(t *testing.T) {
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "3")
+	db := newTestDB(t)
+	secret, err := newTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Email: "u@example.com", TOTPEnabled: true, TOTPSecret: secret}
+	db.Create(&user)
+
+	h := NewAuthHandler(db)
+	r := gin.New()
+	r.POST("/disable", signedInAs(user.ID), h.DisableTwoFactor)
+	r.POST("/recovery-codes", signedInAs(user.ID), h.RegenerateRecoveryCodes)
+	post := func(path, code string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(`{"code":"`+code+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, path := range []string{"/disable", "/recovery-codes", "/disable"} {
+		if code := post(path, "not-a-code"); code != http.StatusBadRequest {
+			t.Fatalf("%s with a wrong code: status = %d, want 400", path, code)
+		}
+	}
+
+	// Locked now, so even the right code is refused
+	valid, err := totpCode(secret, time.Now().Unix()/30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := post("/disable", valid); code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429 while locked", code)
+	}
+	db.First(&user, user.ID)
+	if !user.TOTPEnabled {
+		t.Fatal("2FA was disabled while the account was locked")
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// fileSHA256 returns the hex digest of a file, or "" if it cannot be read
+func fileSHA256(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// BackfillReportHashes hashes report files stored before hashes were recorded
+func BackfillReportHashes(db *gorm.DB) {
+	var reports []models.Report
+	db.Where("file_path <> '' AND (sha256 IS NULL OR sha256 = '')").Find(&reports)
+	for _, report := range reports {
+		if sum := fileSHA256(filepath.Join("uploads", report.FilePath)); sum != "" {
+			db.Model(&report).Update("sha256", sum)
+		}
+	}
+}
+
+// VerifyReport (Public) lets a third party confirm a Checkmate report is genuine.
+// It returns the scores, completion date and report hashes for a verification
+// code, never the document or who submitted it. Pass ?sha256=<digest> to check
+// a specific file against the issued reports.
+func (h *OrderHandler) VerifyReport(c *gin.Context) {
+	code := strings.ToUpper(strings.TrimSpace(c.Param("code")))
+
+	var order models.Order
+	err := h.DB.Unscoped().Preload("Reports").
+		Where("verification_code = ? AND status = ?", code, models.StatusCompleted).
+		First(&order).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"valid": false, "error": "No report found for this verification code"})
+		return
+	}
+
+	type verifiedReport struct {
+		Type   models.ReportType `json:"type"`
+		Score  *int              `json:"score"`
+		SHA256 string            `json:"sha256"`
+	}
+	reports := []verifiedReport{}
+	for _, report := range order.Reports {
+		reports = append(reports, verifiedReport{Type: report.Type, Score: report.Score, SHA256: report.SHA256})
+	}
+
+	response := gin.H{
+		"valid":             true,
+		"verification_code": code,
+		"ai_score":          order.AIScore,
+		"sim_score":         order.SimScore,
+		"word_count":        order.WordCount,
+		"submitted_at":      order.CreatedAt,
+		"completed_at":      order.CompletedAt,
+		"reports":           reports,
+	}
+
+	if digest := strings.ToLower(strings.TrimSpace(c.Query("sha256"))); digest != "" {
+		matches := false
+		for _, report := range order.Reports {
+			if report.SHA256 != "" && report.SHA256 == digest {
+				matches = true
+			}
+		}
+		response["hash_matches"] = matches
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// countWords makes a best-effort word count of an uploaded document.
+// Plain text and .docx are read fully; PDFs are read from their text
+// operators; formats we cannot parse (e.g. legacy .doc) return 0.
+func countWords(path string) int {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".txt":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0
+		}
+		return len(strings.Fields(string(data)))
+	case ".docx":
+		return len(strings.Fields(docxText(path)))
+	case ".pdf":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0
+		}
+		return len(strings.Fields(pdfText(data)))
+	}
+	return 0
+}
+
+// docxText extracts the visible text of a .docx (word/document.xml)
+func docxText(path string) string {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return ""
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if file.Name != "word/document.xml" {
+			continue
+		}
+		if file.UncompressedSize64 > maxInflatedBytes {
+			return ""
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return ""
+		}
+		defer rc.Close()
+
+		// The declared size can lie, so cap what is actually read too
+		var text strings.Builder
+		decoder := xml.NewDecoder(io.LimitReader(rc, maxInflatedBytes))
+		inText := false
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				break
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				inText = t.Name.Local == "t"
+				if t.Name.Local == "tab" || t.Name.Local == "br" {
+					text.WriteByte(' ')
+				}
+			case xml.EndElement:
+				inText = false
+				if t.Name.Local == "p" {
+					text.WriteByte('\n')
+				}
+			case xml.CharData:
+				if inText {
+					text.Write(t)
+				}
+			}
+		}
+		return text.String()
+	}
+	return ""
+}
+
+// maxInflatedBytes caps how much a single document may decompress to while
+// being counted, so a small file with a compression bomb can't exhaust memory
+const maxInflatedBytes = 64 << 20
+
+var (
+	pdfStreamPattern = regexp.MustCompile(`(?s)stream\r?\n(.*?)endstream`)
+	pdfTextBlock     = regexp.MustCompile(`(?s)BT(.*?)ET`)
+)
+
+// pdfText pulls the literal strings out of every text block in a PDF's
+// content streams (inflating Flate-compressed streams). Fonts with custom
+// encodings will not decode, so treat the result as an estimate. Counting
+// stops at the text found so far once maxInflatedBytes is used up.
+func pdfText(data []byte) string {
+	var text strings.Builder
+	budget := int64(maxInflatedBytes)
+	for _, match := range pdfStreamPattern.FindAllSubmatch(data, -1) {
+		stream := match[1]
+		if r, err := zlib.NewReader(bytes.NewReader(stream)); err == nil {
+			inflated, err := io.ReadAll(io.LimitReader(r, budget+1))
+			r.Close()
+			if int64(len(inflated)) > budget {
+				break
+			}
+			budget -= int64(len(inflated))
+			if err == nil || len(inflated) > 0 {
+				stream = inflated
+			}
+		}
+		for _, block := range pdfTextBlock.FindAllSubmatch(stream, -1) {
+			text.WriteString(pdfBlockStrings(block[1]))
+			text.WriteByte('\n')
+		}
+	}
+	return text.String()
+}
+
+// pdfBlockStrings concatenates the (literal) strings in a BT/ET block.
+// Large negative kerning inside TJ arrays is treated as a word gap.
+func pdfBlockStrings(block []byte) string {
+	var out strings.Builder
+	for i := 0; i < len(block); i++ {
+		switch block[i] {
+		case '(':
+			depth := 1
+			for i++; i < len(block) && depth > 0; i++ {
+				c := block[i]
+				switch {
+				case c == '\\' && i+1 < len(block):
+					i++
+					switch block[i] {
+					case 'n', 'r', 't':
+						out.WriteByte(' ')
+					default:
+						out.WriteByte(block[i])
+					}
+				case c == '(':
+					depth++
+					out.WriteByte(c)
+				case c == ')':
+					depth--
+					if depth > 0 {
+						out.WriteByte(c)
+					}
+				default:
+					out.WriteByte(c)
+				}
+			}
+			i--
+		case '-':
+			// Kerning value such as -250 between TJ strings
+			j := i + 1
+			for j < len(block) && (block[j] >= '0' && block[j] <= '9' || block[j] == '.') {
+				j++
+			}
+			if j-i > 3 {
+				out.WriteByte(' ')
+			}
+			i = j - 1
+		case 'T':
+			// Tj / TJ / T* / Td end a run of text
+			if i+1 < len(block) && strings.ContainsRune("jJ*dD", rune(block[i+1])) {
+				out.WriteByte(' ')
+			}
+		}
+	}
+	return out.String()
+}
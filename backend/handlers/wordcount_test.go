@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDocx saves a .docx whose document.xml is body, written in chunks
+func writeDocx(t *testing.T, chunks func(write func(string))) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "doc.docx")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(file)
+	w, err := archive.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks(func(s string) { w.Write([]byte(s)) })
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	return path
+}
+
+func TestDocxWordCount(t *testing.T) {
+	path := writeDocx(t, func(write func(string)) {
+		write(`<w:document><w:body><w:p><w:r><w:t>Three little words</w:t></w:r></w:p>`)
+		write(`<w:p><w:r><w:t>and</w:t><w:tab/><w:t>five more here too</w:t></w:r></w:p></w:body></w:document>`)
+	})
+	if got := countWords(path); got != 8 {
+		t.Fatalf("countWords = %d, want 8", got)
+	}
+}
+
+func TestDocxCompressionBombIsNotInflated(t *testing.T) {
+	// Far past maxInflatedBytes once inflated, a few hundred KB on disk
+	chunk := strings.Repeat("<w:t>a</w:t>", 1<<16)
+	path := writeDocx(t, func(write func(string)) {
+		write(`<w:document><w:body><w:p>`)
+		for written := 0; written <= maxInflatedBytes; written += len(chunk) {
+			write(chunk)
+		}
+		write(`</w:p></w:body></w:document>`)
+	})
+	if info, _ := os.Stat(path); info.Size() > 2<<20 {
+		t.Fatalf("test file is %d bytes; expected a small bomb", info.Size())
+	}
+	if got := countWords(path); got != 0 {
+		t.Fatalf("countWords = %d for a document over the limit, want 0", got)
+	}
+}
+
+func TestPDFCompressionBombStopsAtBudget(t *testing.T) {
+	var stream bytes.Buffer
+	w := zlib.NewWriter(&stream)
+	zeros := make([]byte, 1<<20)
+	for i := 0; i <= maxInflatedBytes>>20; i++ {
+		w.Write(zeros)
+	}
+	w.Close()
+	pdf := append([]byte("%PDF-1.4\nstream\n"), stream.Bytes()...)
+	pdf = append(pdf, []byte("endstream\nstream\nBT (after) Tj ET\nendstream\n")...)
+
+	if text := pdfText(pdf); strings.Contains(text, "after") {
+		t.Fatal("kept reading streams after the inflate budget ran out")
+	}
+}
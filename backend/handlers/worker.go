@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"checkmate-backend/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WorkerHandler struct {
+	DB                  *gorm.DB
+	NotificationHandler *NotificationHandler
+}
+
+func NewWorkerHandler(db *gorm.DB, notificationHandler *NotificationHandler) *WorkerHandler {
+	return &WorkerHandler{
+		DB:                  db,
+		NotificationHandler: notificationHandler,
+	}
+}
+
+// workerLease is how long a worker may hold an order without sending a heartbeat
+func workerLease() time.Duration {
+	return time.Duration(envInt("WORKER_LEASE_SECONDS", 300)) * time.Second
+}
+
+// Register issues a token to a new worker. Workers prove they are ours with the
+// shared WORKER_REGISTRATION_SECRET; registration is disabled when it is unset.
+func (h *WorkerHandler) Register(c *gin.Context) {
+	secret := os.Getenv("WORKER_REGISTRATION_SECRET")
+	provided := c.GetHeader("X-Worker-Registration-Secret")
+	if secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(provided)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid registration secret"})
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := c.BindJSON(&body); err != nil || body.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Worker name required"})
+		return
+	}
+
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	token := hex.EncodeToString(bytes)
+	sum := sha256.Sum256([]byte(token))
+
+	worker := models.Worker{
+		Name:      body.Name,
+		TokenHash: hex.EncodeToString(sum[:]),
+	}
+	if err := h.DB.Create(&worker).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register worker"})
+		return
+	}
+	recordAudit(c, h.DB, "worker.register", "worker", worker.ID, gin.H{"name": worker.Name})
+
+	// The token is only ever shown once
+	c.JSON(http.StatusOK, gin.H{"worker": worker, "token": token})
+}
+
+// Lease long-polls for the next queued order (up to ?wait seconds, max 60) and
+// hands it to the calling worker. Responds 204 when nothing became available.
+func (h *WorkerHandler) Lease(c *gin.Context) {
+	workerID := c.MustGet("workerID").(uint)
+
+	wait := 25
+	if w, ok := parsePositiveInt(c.Query("wait")); ok {
+		wait = w
+	}
+	if wait > 60 {
+		wait = 60
+	}
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+
+	for {
+		order, err := h.leaseNext(workerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lease order"})
+			return
+		}
+		if order != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"order":            order,
+				"lease_expires_at": order.ClaimExpiresAt,
+			})
+			return
+		}
+
+		if time.Now().After(deadline) {
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// leaseNext atomically moves the first available pending order to the worker
+func (h *WorkerHandler) leaseNext(workerID uint) (*models.Order, error) {
+	now := time.Now()
+
+	var candidates []models.Order
+	err := h.DB.Where("status = ? AND worker_id IS NULL", models.StatusPending).
+		Where("assigned_to IS NULL OR claim_expires_at < ?", now).
+		Order(queueOrder).Limit(5).Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range candidates {
+		// Conditional update: only one worker (or admin) can win each order
+		result := h.DB.Model(&models.Order{}).
+			Where("id = ? AND status = ? AND worker_id IS NULL", candidate.ID, models.StatusPending).
+			Where("assigned_to IS NULL OR claim_expires_at < ?", now).
+			Updates(map[string]interface{}{
+				"status":           models.StatusProcessing,
+				"worker_id":        workerID,
+				"assigned_to":      nil,
+				"claimed_at":       now,
+				"claim_expires_at": now.Add(workerLease()),
+				"attempts":         gorm.Expr("attempts + 1"),
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			var order models.Order
+			if err := h.DB.First(&order, candidate.ID).Error; err != nil {
+				return nil, err
+			}
+			return &order, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// leasedOrder loads an order and checks the calling worker still holds its lease
+func (h *WorkerHandler) leasedOrder(c *gin.Context) (*models.Order, bool) {
+	workerID := c.MustGet("workerID").(uint)
+
+	var order models.Order
+	if err := h.DB.First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return nil, false
+	}
+
+	if order.Status != models.StatusProcessing || order.WorkerID == nil || *order.WorkerID != workerID ||
+		order.ClaimExpiresAt == nil || order.ClaimExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Lease lost or expired"})
+		return nil, false
+	}
+
+	return &order, true
+}
+
+// Source streams the uploaded document for a leased order
+func (h *WorkerHandler) Source(c *gin.Context) {
+	order, ok := h.leasedOrder(c)
+	if !ok {
+		return
+	}
+
+	if _, err := os.Stat(order.LocalFilePath); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source file missing"})
+		return
+	}
+
+	c.FileAttachment(order.LocalFilePath, order.OriginalFilename)
+}
+
+// Heartbeat extends the lease on an order the worker is still processing
+func (h *WorkerHandler) Heartbeat(c *gin.Context) {
+	order, ok := h.leasedOrder(c)
+	if !ok {
+		return
+	}
+
+	expires := time.Now().Add(workerLease())
+	result := h.DB.Model(&models.Order{}).
+		Where("id = ? AND worker_id = ?", order.ID, *order.WorkerID).
+		Update("claim_expires_at", expires)
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Lease lost or expired"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lease_expires_at": expires})
+}
+
+// Complete accepts report files and scores (same form fields as AdminComplete)
+func (h *WorkerHandler) Complete(c *gin.Context) {
+	order, ok := h.leasedOrder(c)
+	if !ok {
+		return
+	}
+
+	order.FailureReason = ""
+	if err := applyCompletion(c, h.DB, order, fmt.Sprintf("worker:%d", *order.WorkerID)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order completed", "order": order})
+}
+
+// Fail gives an order back with a reason. It is re-queued until it has been
+// attempted WORKER_MAX_ATTEMPTS times (or retry is false), then marked Failed.
+func (h *WorkerHandler) Fail(c *gin.Context) {
+	order, ok := h.leasedOrder(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+		Retry  *bool  `json:"retry"`
+	}
+	if err := c.BindJSON(&body); err != nil || body.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failure reason required"})
+		return
+	}
+
+	retry := body.Retry == nil || *body.Retry
+	status := models.StatusPending
+	if !retry || order.Attempts >= envInt("WORKER_MAX_ATTEMPTS", 3) {
+		status = models.StatusFailed
+	}
+
+	h.DB.Model(order).Updates(map[string]interface{}{
+		"status":           status,
+		"failure_reason":   body.Reason,
+		"worker_id":        nil,
+		"claimed_at":       nil,
+		"claim_expires_at": nil,
+	})
+
+	if status == models.StatusFailed && h.NotificationHandler != nil {
+		go h.NotificationHandler.SendToAdmins(
+			"⚠️ Order Processing Failed",
+			fmt.Sprintf("Order #%d \"%s\" failed: %s", order.ID, order.OriginalFilename, body.Reason),
+			"/dashboard/admin/orders",
+		)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Failure recorded", "status": status})
+}
+
+// AdminListWorkers shows registered workers and when they last checked in
+func (h *WorkerHandler) AdminListWorkers(c *gin.Context) {
+	var workers []models.Worker
+	if err := h.DB.Order("created_at desc").Find(&workers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch workers"})
+		return
+	}
+	c.JSON(http.StatusOK, workers)
+}
+
+// AdminDisableWorker revokes a worker's token and returns its leases to the queue
+func (h *WorkerHandler) AdminDisableWorker(c *gin.Context) {
+	var worker models.Worker
+	if err := h.DB.First(&worker, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Worker not found"})
+		return
+	}
+
+	worker.Disabled = true
+	h.DB.Save(&worker)
+	released := releaseWorkerLeases(h.DB, "worker_id = ?", worker.ID)
+	recordAuditChange(c, h.DB, "worker.disable", "worker", worker.ID,
+		gin.H{"disabled": false}, gin.H{"disabled": true}, gin.H{"name": worker.Name, "orders_released": released})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Worker disabled"})
+}
+
+// releaseWorkerLeases puts worker-held processing orders matching the condition back into the pending queue
+func releaseWorkerLeases(db *gorm.DB, query string, args ...interface{}) int64 {
+	return db.Model(&models.Order{}).
+		Where("status = ? AND worker_id IS NOT NULL", models.StatusProcessing).
+		Where(query, args...).
+		Updates(map[string]interface{}{
+			"status":           models.StatusPending,
+			"worker_id":        nil,
+			"claimed_at":       nil,
+			"claim_expires_at": nil,
+		}).RowsAffected
+}
+
+// StartWorkerLeaseJob periodically returns orders abandoned by workers to the queue
+func StartWorkerLeaseJob(db *gorm.DB) {
+	ticker := time.NewTicker(30 * time.Second)
+
+	go func() {
+		for range ticker.C {
+			released := releaseWorkerLeases(db, "claim_expires_at < ?", time.Now())
+			if released > 0 {
+				fmt.Printf("[LEASES] Returned %d abandoned orders to the queue\n", released)
+			}
+		}
+	}()
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"checkmate-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// asWorker stands in for RequireWorker
+func asWorker(workerID uint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("workerID", workerID)
+		c.Next()
+	}
+}
+
+func newWorkerRouter(h *WorkerHandler, workerID uint) *gin.Engine {
+	r := gin.New()
+	r.Use(asWorker(workerID))
+	r.GET("/lease", h.Lease)
+	r.POST("/orders/:id/heartbeat", h.Heartbeat)
+	r.POST("/orders/:id/fail", h.Fail)
+	return r
+}
+
+func TestConcurrentWorkersLeaseAnOrderOnce(t *testing.T) {
+	db := newTestDB(t)
+	db.Create(&models.Order{UserID: 1, Status: models.StatusPending})
+	h := NewWorkerHandler(db, nil)
+
+	const workers = 6
+	codes := make([]int, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			newWorkerRouter(h, uint(i+1)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/lease?wait=1", nil))
+			codes[i] = w.Code
+		}(i)
+	}
+	wg.Wait()
+
+	leased := 0
+	for _, code := range codes {
+		if code == http.StatusOK {
+			leased++
+		}
+	}
+	if leased != 1 {
+		t.Fatalf("order leased %d times (statuses %v), want once", leased, codes)
+	}
+}
+
+func TestWorkerFailRequeuesUntilMaxAttempts(t *testing.T) {
+	t.Setenv("WORKER_MAX_ATTEMPTS", "2")
+	db := newTestDB(t)
+	order := models.Order{UserID: 1, Status: models.StatusPending}
+	db.Create(&order)
+	h := NewWorkerHandler(db, nil)
+	r := newWorkerRouter(h, 1)
+
+	for attempt, want := range []models.OrderStatus{models.StatusPending, models.StatusFailed} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/lease?wait=1", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("attempt %d: lease status = %d", attempt+1, w.Code)
+		}
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/orders/%d/fail", order.ID), bytes.NewBufferString(`{"reason":"engine timeout"}`))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("attempt %d: fail status = %d", attempt+1, w.Code)
+		}
+		db.First(&order, order.ID)
+		if order.Status != want || order.WorkerID != nil {
+			t.Fatalf("attempt %d: status %q worker %v, want %q and no worker", attempt+1, order.Status, order.WorkerID, want)
+		}
+	}
+}
+
+func TestWorkerCannotTouchAnotherWorkersLease(t *testing.T) {
+	db := newTestDB(t)
+	order := models.Order{UserID: 1, Status: models.StatusPending}
+	db.Create(&order)
+	h := NewWorkerHandler(db, nil)
+
+	w := httptest.NewRecorder()
+	newWorkerRouter(h, 1).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/lease?wait=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("lease status = %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	newWorkerRouter(h, 2).ServeHTTP(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/orders/%d/heartbeat", order.ID), nil))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("heartbeat by another worker: status = %d, want 409", w.Code)
+	}
+}
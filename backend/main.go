@@ -22,13 +22,18 @@ func main() {
 	godotenv.Load()
 
 	// DB Setup
-	db, err := gorm.Open(sqlite.Open("checkmate.db"), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open("checkmate.db?_pragma=busy_timeout(5000)"), &gorm.Config{})
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
 	// Migrate
-	db.AutoMigrate(&models.User{}, &models.Order{}, &models.UserCredits{}, &models.Transaction{}, &models.VerificationCode{}, &models.PasswordResetToken{}, &models.PricingPackage{}, &models.PushSubscription{})
+	handlers.MarkExistingUsersVerified(db)
+	db.AutoMigrate(&models.User{}, &models.Order{}, &models.UserCredits{}, &models.Transaction{}, &models.VerificationCode{}, &models.PasswordResetToken{}, &models.PricingPackage{}, &models.PushSubscription{}, &models.Worker{}, &models.Report{}, &models.OrderMessage{}, &models.Session{}, &models.RefreshToken{}, &models.Role{}, &models.RecoveryCode{}, &models.RateLimitBucket{}, &models.UserIdentity{}, &models.OIDCLogin{}, &models.MagicLinkToken{}, &models.AuditLog{}, &models.Impersonation{})
+	handlers.SeedRoles(db)
+	handlers.DropPlaintextCodes(db)
+	handlers.MigrateLegacyReports(db)
+	handlers.BackfillReportHashes(db)
 
 	// Seed Packages
 	var count int64
@@ -48,25 +53,30 @@ func main() {
 	notificationHandler := handlers.NewNotificationHandler(db)
 	paymentHandler := handlers.NewPaymentHandler(db, notificationHandler)
 	orderHandler := handlers.NewOrderHandler(db, notificationHandler)
+	workerHandler := handlers.NewWorkerHandler(db, notificationHandler)
+	messageHandler := handlers.NewMessageHandler(db, notificationHandler)
+	roleHandler := handlers.NewRoleHandler(db)
+	oidcHandler := handlers.NewOIDCHandler(db)
+	profileHandler := handlers.NewProfileHandler(db)
+	auditHandler := handlers.NewAuditHandler(db)
 
 	// Start background cleanup job (delete orders older than 5 hours)
 	handlers.StartCleanupJob(db, 5)
 
+	// Return orders abandoned by remote workers to the queue
+	handlers.StartWorkerLeaseJob(db)
+
 	// AUTO-PROMOTE ADMIN (If defined in .env)
 	adminEmail := os.Getenv("ADMIN_EMAIL")
-	if adminEmail != "" {
-		var user models.User
-		if err := db.Where("email = ?", adminEmail).First(&user).Error; err == nil {
-			if !user.IsAdmin {
-				user.IsAdmin = true
-				db.Save(&user)
-				log.Println("Successfully promoted " + adminEmail + " to admin")
-			}
-		}
+	if handlers.PromoteAdminEmail(db, adminEmail) {
+		log.Println("Successfully promoted " + adminEmail + " to superadmin")
 	}
 
 	// Router
 	r := gin.Default()
+	if err := middleware.TrustProxies(r); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
 
 	// CORS
 	origins := os.Getenv("ALLOWED_ORIGINS")
@@ -83,50 +93,160 @@ func main() {
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// Rate limits for auth endpoints (RATE_LIMIT_STORE=db shares counters across instances)
+	var limitStore middleware.RateLimitStore = middleware.NewMemoryStore()
+	if os.Getenv("RATE_LIMIT_STORE") == "db" {
+		limitStore = middleware.NewDBStore(db)
+	}
+	limit := func(name string, n int, window time.Duration, key middleware.RateLimitKey) gin.HandlerFunc {
+		return middleware.RateLimit(limitStore, name, n, window, key)
+	}
+	// Routes that check a password or code refuse requests while the store is down
+	strictLimit := func(name string, n int, window time.Duration, key middleware.RateLimitKey) gin.HandlerFunc {
+		return middleware.RateLimitStrict(limitStore, name, n, window, key)
+	}
+	perIP, perEmail, perUser := middleware.ByIP, middleware.ByEmail, middleware.ByUser
+
 	// Routes
-	r.POST("/auth/signup", authHandler.Signup)
-	r.POST("/auth/login", authHandler.Login)
-	r.POST("/auth/otp", authHandler.SendOTP)
-	r.POST("/auth/google", authHandler.GoogleLogin)
-	r.POST("/auth/forgot-password", authHandler.ForgotPassword)
-	r.POST("/auth/reset-password", authHandler.ResetPassword)
+	r.POST("/auth/signup", limit("signup", 10, time.Hour, perIP), authHandler.Signup)
+	r.POST("/auth/login", strictLimit("login", 20, 15*time.Minute, perIP), strictLimit("login", 10, 15*time.Minute, perEmail), authHandler.Login)
+	r.POST("/auth/login/2fa", strictLimit("login-2fa", 10, 15*time.Minute, perIP), authHandler.LoginTwoFactor)
+	r.POST("/auth/google", limit("google", 30, 15*time.Minute, perIP), authHandler.GoogleLogin)
+	// Institutional single sign-on (OpenID Connect)
+	r.GET("/auth/oidc/providers", oidcHandler.ListProviders)
+	r.GET("/auth/oidc/:provider/start", limit("oidc", 30, 15*time.Minute, perIP), oidcHandler.Start)
+	r.GET("/auth/oidc/:provider/callback", limit("oidc-callback", 30, 15*time.Minute, perIP), oidcHandler.Callback)
+	r.POST("/auth/oidc/exchange", limit("oidc-exchange", 30, 15*time.Minute, perIP), oidcHandler.Exchange)
+	r.POST("/auth/magic-link", limit("magic-link", 10, time.Hour, perIP), limit("magic-link", 3, 15*time.Minute, perEmail), authHandler.RequestMagicLink)
+	r.POST("/auth/magic-link/verify", strictLimit("magic-link-verify", 20, 15*time.Minute, perIP), authHandler.MagicLinkLogin)
+	r.POST("/auth/forgot-password", limit("forgot", 10, time.Hour, perIP), limit("forgot", 3, time.Hour, perEmail), authHandler.ForgotPassword)
+	r.GET("/auth/password-policy", authHandler.GetPasswordPolicy)
+	r.POST("/auth/reset-password", strictLimit("reset", 10, 15*time.Minute, perIP), authHandler.ResetPassword)
+	r.POST("/auth/refresh", limit("refresh", 60, time.Minute, perIP), authHandler.Refresh)
+	r.POST("/auth/logout", authHandler.Logout)
 	r.GET("/packages", pkgHandler.ListPackages)
+	r.GET("/verify/:code", limit("verify", 30, time.Minute, perIP), orderHandler.VerifyReport)
+
+	// Remote Worker API (headless processing agents)
+	r.POST("/worker/register", workerHandler.Register)
+	worker := r.Group("/worker")
+	worker.Use(middleware.RequireWorker(db))
+	{
+		worker.GET("/lease", workerHandler.Lease)
+		worker.GET("/orders/:id/source", workerHandler.Source)
+		worker.POST("/orders/:id/heartbeat", workerHandler.Heartbeat)
+		worker.POST("/orders/:id/complete", workerHandler.Complete)
+		worker.POST("/orders/:id/fail", workerHandler.Fail)
+	}
 
 	// Protected Routes
 	authorized := r.Group("/")
-	authorized.Use(middleware.RequireAuth)
+	authorized.Use(middleware.RequireAuth(db))
 	{
 		authorized.POST("/upload", orderHandler.Upload)
 		authorized.GET("/user/orders", orderHandler.ListOrders)
 		authorized.DELETE("/user/orders/:id", orderHandler.DeleteOrder)
+		authorized.GET("/user/orders/:id/reports", orderHandler.ListReports)
+		authorized.GET("/user/orders/:id/compare", orderHandler.CompareRevision)
 		authorized.GET("/download/:filename", orderHandler.Download)
+		authorized.POST("/user/logout-all", authHandler.LogoutAll)
+		authorized.GET("/user/sessions", authHandler.ListSessions)
+		authorized.DELETE("/user/sessions/:id", authHandler.RevokeSession)
+
+		// Profile & self-service
+		authorized.GET("/user/profile", profileHandler.GetProfile)
+		authorized.PUT("/user/profile", profileHandler.UpdateProfile)
+		authorized.POST("/user/profile/email", limit("email-change", 5, time.Hour, perIP), profileHandler.RequestEmailChange)
+		authorized.POST("/user/profile/email/confirm", profileHandler.ConfirmEmailChange)
+		authorized.POST("/user/verify-email", limit("verify-email", 5, time.Hour, perIP), profileHandler.SendEmailVerification)
+		authorized.POST("/user/verify-email/confirm", profileHandler.ConfirmEmailVerification)
+		authorized.PUT("/user/profile/password", profileHandler.ChangePassword)
+		authorized.GET("/user/profile/purchases", profileHandler.ListPurchases)
+		authorized.GET("/user/export", limit("export", 5, time.Hour, perIP), profileHandler.ExportData)
+		authorized.DELETE("/user/account", profileHandler.DeleteAccount)
+		authorized.POST(middleware.ImpersonationEndPath, authHandler.EndImpersonation)
+
+		// Sign-in methods (password, Google, single sign-on)
+		authorized.GET("/user/identities", authHandler.ListIdentities)
+		authorized.POST("/user/identities/google", authHandler.LinkGoogle)
+		authorized.POST("/user/identities/password", authHandler.SetPassword)
+		authorized.POST("/user/identities/oidc/:provider", oidcHandler.StartLink)
+		authorized.DELETE("/user/identities/:id", authHandler.UnlinkIdentity)
+
+		// Two-factor authentication
+		authorized.GET("/user/2fa", authHandler.TwoFactorStatus)
+		authorized.POST("/user/2fa/setup", authHandler.SetupTwoFactor)
+		authorized.POST("/user/2fa/enable", authHandler.EnableTwoFactor)
+		authorized.POST("/user/2fa/disable", strictLimit("2fa-manage", 10, 15*time.Minute, perUser), authHandler.DisableTwoFactor)
+		authorized.POST("/user/2fa/recovery-codes", strictLimit("2fa-manage", 10, 15*time.Minute, perUser), authHandler.RegenerateRecoveryCodes)
+
+		// Order messages
+		authorized.GET("/user/orders/:id/messages", messageHandler.ListMessages)
+		authorized.POST("/user/orders/:id/messages", messageHandler.PostMessage)
+		authorized.GET("/user/messages/unread", messageHandler.UnreadMessages)
+
+		// User push notifications (message replies)
+		authorized.GET("/user/vapid-public-key", notificationHandler.GetVAPIDPublicKey)
+		authorized.POST("/user/subscribe-notifications", notificationHandler.Subscribe)
+		authorized.POST("/user/unsubscribe-notifications", notificationHandler.Unsubscribe)
 
 		// Payment routes
-		authorized.POST("/payment/initiate", paymentHandler.InitiatePayment)
+		authorized.POST("/payment/initiate", middleware.RequireVerifiedEmail(db), paymentHandler.InitiatePayment)
 		authorized.GET("/payment/status/:invoice_id", paymentHandler.CheckPaymentStatus)
 		authorized.GET("/user/credits", paymentHandler.GetUserCredits)
 
-		// Admin
+		// Admin (each route checks the staff permission it needs)
+		can := func(permission string) gin.HandlerFunc { return middleware.RequirePermission(db, permission) }
 		admin := authorized.Group("/admin")
-		admin.Use(middleware.RequireAdmin)
 		{
-			admin.GET("/users", authHandler.AdminListUsers)
-			admin.GET("/orders", orderHandler.AdminListOrders)
-			admin.POST("/complete/:id", orderHandler.AdminComplete)
-			admin.POST("/processing/:id", orderHandler.AdminStartProcessing)
-			admin.GET("/transactions", paymentHandler.AdminListTransactions)
-			admin.POST("/transactions/:reference/verify", paymentHandler.AdminVerifyTransaction)
+			admin.GET("/users", can(models.PermUsersView), authHandler.AdminListUsers)
+			admin.GET("/users/:id", can(models.PermUsersView), authHandler.AdminGetUser)
+			admin.POST("/users/:id/suspend", can(models.PermUsersManage), authHandler.AdminSuspendUser)
+			admin.POST("/users/:id/unsuspend", can(models.PermUsersManage), authHandler.AdminUnsuspendUser)
+			admin.POST("/users/:id/slots", can(models.PermCreditsGrant), authHandler.AdminAdjustSlots)
+			admin.POST("/users/:id/reset-password", can(models.PermUsersManage), authHandler.AdminSendPasswordReset)
+			admin.POST("/users/:id/impersonate", can(models.PermUsersImpersonate), authHandler.AdminStartImpersonation)
+			admin.GET("/orders", can(models.PermOrdersView), orderHandler.AdminListOrders)
+			admin.GET("/orders/sla", can(models.PermOrdersView), orderHandler.AdminSLAStats)
+			admin.POST("/orders/:id/claim", can(models.PermOrdersProcess), orderHandler.AdminClaimOrder)
+			admin.POST("/orders/:id/release", can(models.PermOrdersProcess), orderHandler.AdminReleaseOrder)
+			admin.POST("/orders/:id/assign", can(models.PermOrdersAssign), orderHandler.AdminReassignOrder)
+			admin.GET("/operators/stats", can(models.PermOrdersAssign), orderHandler.AdminOperatorStats)
+
+			// Order messages
+			admin.GET("/orders/:id/messages", can(models.PermOrdersView), messageHandler.AdminListMessages)
+			admin.POST("/orders/:id/messages", can(models.PermOrdersMessage), messageHandler.AdminPostMessage)
+			admin.GET("/messages/unread", can(models.PermOrdersView), messageHandler.AdminUnreadMessages)
+
+			// Remote Workers
+			admin.GET("/workers", can(models.PermWorkersManage), workerHandler.AdminListWorkers)
+			admin.POST("/workers/:id/disable", can(models.PermWorkersManage), workerHandler.AdminDisableWorker)
+			admin.POST("/complete/:id", can(models.PermOrdersProcess), orderHandler.AdminComplete)
+			admin.POST("/processing/:id", can(models.PermOrdersProcess), orderHandler.AdminStartProcessing)
+			admin.GET("/transactions", can(models.PermTransactionsView), paymentHandler.AdminListTransactions)
+			admin.POST("/transactions/:reference/verify", can(models.PermTransactionsVerify), paymentHandler.AdminVerifyTransaction)
 
 			// Packages
-			admin.GET("/packages", pkgHandler.ListPackages)
-			admin.POST("/packages", pkgHandler.AdminCreatePackage)
-			admin.PUT("/packages/:id", pkgHandler.AdminUpdatePackage)
-			admin.DELETE("/packages/:id", pkgHandler.AdminDeletePackage)
+			admin.GET("/packages", can(models.PermPackagesManage), pkgHandler.ListPackages)
+			admin.POST("/packages", can(models.PermPackagesManage), pkgHandler.AdminCreatePackage)
+			admin.PUT("/packages/:id", can(models.PermPackagesManage), pkgHandler.AdminUpdatePackage)
+			admin.DELETE("/packages/:id", can(models.PermPackagesManage), pkgHandler.AdminDeletePackage)
+
+			// Roles
+			admin.GET("/roles", can(models.PermRolesManage), roleHandler.AdminListRoles)
+			admin.POST("/roles", can(models.PermRolesManage), roleHandler.AdminCreateRole)
+			admin.PUT("/roles/:id", can(models.PermRolesManage), roleHandler.AdminUpdateRole)
+			admin.DELETE("/roles/:id", can(models.PermRolesManage), roleHandler.AdminDeleteRole)
+			admin.PUT("/users/:id/roles", can(models.PermRolesManage), roleHandler.AdminSetUserRoles)
+
+			// Audit log
+			admin.GET("/audit", can(models.PermAuditView), auditHandler.AdminListAudit)
+			admin.GET("/audit/export", can(models.PermAuditView), auditHandler.AdminExportAudit)
 
 			// Notifications
-			admin.GET("/vapid-public-key", notificationHandler.GetVAPIDPublicKey)
-			admin.POST("/subscribe-notifications", notificationHandler.Subscribe)
-			admin.POST("/unsubscribe-notifications", notificationHandler.Unsubscribe)
+			admin.GET("/vapid-public-key", can(models.PermNotifications), notificationHandler.GetVAPIDPublicKey)
+			admin.POST("/subscribe-notifications", can(models.PermNotifications), notificationHandler.Subscribe)
+			admin.POST("/unsubscribe-notifications", can(models.PermNotifications), notificationHandler.Unsubscribe)
 		}
 	}
 
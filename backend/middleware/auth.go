@@ -4,61 +4,154 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"checkmate-backend/models"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
-func RequireAuth(c *gin.Context) {
-	// Get token from header
-	tokenString := c.GetHeader("Authorization")
-	if tokenString == "" {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-		return
-	}
+// RequireAuth validates the access token and checks that its session is
+// still active, so signing a device out takes effect immediately
+func RequireAuth(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get token from header
+		tokenString := c.GetHeader("Authorization")
+		if tokenString == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			return
+		}
 
-	// Remove "Bearer " prefix
-	if len(tokenString) > 7 && strings.ToUpper(tokenString[0:7]) == "BEARER " {
-		tokenString = tokenString[7:]
-	}
+		// Remove "Bearer " prefix
+		if len(tokenString) > 7 && strings.ToUpper(tokenString[0:7]) == "BEARER " {
+			tokenString = tokenString[7:]
+		}
+
+		// Parse token
+		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(os.Getenv("JWT_SECRET")), nil
+		})
 
-	// Parse token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		if err != nil || !token.Valid {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
 		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
 
-	if err != nil || !token.Valid {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-		return
-	}
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			return
+		}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		// Check expiration
-		if float64(time.Now().Unix()) > claims["exp"].(float64) {
+		exp, _ := claims["exp"].(float64)
+		if float64(time.Now().Unix()) > exp {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
 			return
 		}
 
+		// Tokens from before sessions existed carry no sid and must log in again
+		sid, _ := claims["sid"].(float64)
+		var session models.Session
+		if sid == 0 || db.First(&session, uint(sid)).Error != nil || session.RevokedAt != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session has been signed out"})
+			return
+		}
+
+		if imp, ok := claims["imp"].(float64); ok {
+			// Impersonation tokens act as the customer but ride on the staff
+			// member's session, and every request is audited
+			impersonation := loadImpersonation(c, db, uint(imp), session, claims["sub"])
+			if impersonation == nil {
+				return
+			}
+			defer recordImpersonatedRequest(c, db, impersonation)
+			if !impersonationAllows(c, impersonation) {
+				return
+			}
+			c.Set("impersonationID", impersonation.ID)
+			c.Set("impersonatorID", impersonation.ActorID)
+			c.Header("X-Impersonated-By", fmt.Sprint(impersonation.ActorID))
+		} else {
+			// Suspension applies at once, even to tokens issued before it
+			var user models.User
+			if db.Select("id", "suspended_at").First(&user, claims["sub"]).Error == nil && user.SuspendedAt != nil {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This account has been suspended", "suspended": true})
+				return
+			}
+		}
+
+		// Only write last-seen occasionally rather than on every request
+		if time.Since(session.LastSeenAt) > time.Minute {
+			db.Model(&session).Updates(map[string]interface{}{"last_seen_at": time.Now(), "ip": c.ClientIP()})
+		}
+
 		// Attach user info to context
 		c.Set("userID", claims["sub"])
 		c.Set("isAdmin", claims["admin"])
+		c.Set("sessionID", session.ID)
 
 		c.Next()
-	} else {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 	}
 }
 
-func RequireAdmin(c *gin.Context) {
-	isAdmin, exists := c.Get("isAdmin")
-	if !exists || isAdmin != true {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required. Please re-login if you were recently promoted."})
-		return
+// Staff2FARequired reports whether REQUIRE_STAFF_2FA forces every staff account to enroll
+func Staff2FARequired() bool {
+	required, _ := strconv.ParseBool(os.Getenv("REQUIRE_STAFF_2FA"))
+	return required
+}
+
+// RequirePermission re-reads the user's roles on every request, so granting
+// or revoking staff access takes effect immediately
+func RequirePermission(db *gorm.DB, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			return
+		}
+
+		var user models.User
+		if err := db.Preload("Roles").First(&user, userID).Error; err != nil || !user.HasPermission(permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You don't have permission to do this"})
+			return
+		}
+
+		// REQUIRE_STAFF_2FA: staff can still sign in, but must enroll before using admin routes
+		if Staff2FARequired() && !user.TOTPEnabled {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":                     "Two-factor authentication is required for staff accounts. Enable it in Account settings.",
+				"two_factor_setup_required": true,
+			})
+			return
+		}
+
+		c.Set("isAdmin", true)
+		c.Set("permissions", user.Permissions())
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail keeps accounts that haven't verified their email
+// address away from purchases
+func RequireVerifiedEmail(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		var user models.User
+		if err := db.Select("id", "email_verified").First(&user, userID).Error; err != nil || !user.EmailVerified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":                 "Verify your email address before making a purchase",
+				"verification_required": true,
+			})
+			return
+		}
+		c.Next()
 	}
-	c.Next()
 }
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"checkmate-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// impersonating stores a support agent, a customer and a read-only
+// impersonation on the agent's session, returning the impersonation token
+func impersonating(t *testing.T, db *gorm.DB) (string, models.Impersonation, models.Session) {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+	role := models.Role{Name: "support", Permissions: []string{models.PermUsersImpersonate}}
+	db.Create(&role)
+	agent := models.User{Email: "agent@example.com", Roles: []models.Role{role}}
+	db.Create(&agent)
+	customer := models.User{Email: "customer@example.com"}
+	db.Create(&customer)
+	session := models.Session{UserID: agent.ID, LastSeenAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	db.Create(&session)
+	impersonation := models.Impersonation{ActorID: agent.ID, UserID: customer.ID, SessionID: session.ID, Reason: "ticket 42", ReadOnly: true, ExpiresAt: time.Now().Add(time.Hour)}
+	db.Create(&impersonation)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": customer.ID,
+		"sid": session.ID,
+		"imp": impersonation.ID,
+		"ro":  true,
+		"exp": impersonation.ExpiresAt.Unix(),
+	}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token, impersonation, session
+}
+
+func newImpersonationRouter(db *gorm.DB) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequireAuth(db))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/user/orders", ok)
+	r.POST("/upload", ok)
+	r.GET("/user/sessions", ok)
+	r.POST(ImpersonationEndPath, ok)
+	return r
+}
+
+func send(r *gin.Engine, method, path, token string) int {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestReadOnlyImpersonation(t *testing.T) {
+	db := newTestDB(t, &models.User{}, &models.Role{}, &models.Session{}, &models.Impersonation{}, &models.AuditLog{})
+	token, impersonation, _ := impersonating(t, db)
+	r := newImpersonationRouter(db)
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/user/orders", http.StatusOK},
+		{http.MethodPost, "/upload", http.StatusForbidden},
+		{http.MethodGet, "/user/sessions", http.StatusForbidden},
+		{http.MethodPost, ImpersonationEndPath, http.StatusOK},
+	} {
+		if code := send(r, tc.method, tc.path, token); code != tc.want {
+			t.Fatalf("%s %s: status = %d, want %d", tc.method, tc.path, code, tc.want)
+		}
+	}
+
+	// Refused requests are audited too
+	var audited int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND target_id = ?", "impersonation.request", impersonation.UserID).Count(&audited)
+	if audited != 4 {
+		t.Fatalf("%d requests audited, want 4", audited)
+	}
+}
+
+func TestImpersonationEndsWithItsRecordOrSession(t *testing.T) {
+	db := newTestDB(t, &models.User{}, &models.Role{}, &models.Session{}, &models.Impersonation{}, &models.AuditLog{})
+	token, impersonation, session := impersonating(t, db)
+	r := newImpersonationRouter(db)
+
+	db.Model(&impersonation).Update("ended_at", time.Now())
+	if code := send(r, http.MethodGet, "/user/orders", token); code != http.StatusUnauthorized {
+		t.Fatalf("ended impersonation: status = %d, want 401", code)
+	}
+
+	db.Model(&impersonation).Update("ended_at", nil)
+	db.Model(&session).Update("revoked_at", time.Now())
+	if code := send(r, http.MethodGet, "/user/orders", token); code != http.StatusUnauthorized {
+		t.Fatalf("staff signed out: status = %d, want 401", code)
+	}
+}
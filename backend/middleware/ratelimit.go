@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"checkmate-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RateLimitStore counts hits per key inside a fixed window. Hit records one
+// hit and returns the count so far and when the window resets.
+type RateLimitStore interface {
+	Hit(key string, window time.Duration) (int, time.Time, error)
+}
+
+// MemoryStore keeps counters in process memory. Fine for a single instance;
+// counters reset on restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	count   int
+	resetAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*memoryBucket)}
+}
+
+func (s *MemoryStore) Hit(key string, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, bucket := range s.buckets {
+			if now.After(bucket.resetAt) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	bucket, ok := s.buckets[key]
+	if !ok || now.After(bucket.resetAt) {
+		bucket = &memoryBucket{resetAt: now.Add(window)}
+		s.buckets[key] = bucket
+	}
+	bucket.count++
+	return bucket.count, bucket.resetAt, nil
+}
+
+// DBStore keeps counters in the database so limits hold across restarts
+// and multiple backend instances sharing one database
+type DBStore struct {
+	DB *gorm.DB
+}
+
+// NewDBStore returns a database-backed store and starts sweeping expired counters
+func NewDBStore(db *gorm.DB) *DBStore {
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		for range ticker.C {
+			db.Where("reset_at < ?", time.Now()).Delete(&models.RateLimitBucket{})
+		}
+	}()
+	return &DBStore{DB: db}
+}
+
+// Hit counts with a single upsert, so concurrent requests (or instances)
+// can't read the same count and lose each other's increments
+func (s *DBStore) Hit(key string, window time.Duration) (int, time.Time, error) {
+	now := time.Now()
+	var bucket models.RateLimitBucket
+	err := s.DB.Raw(`INSERT INTO rate_limit_buckets (bucket_key, count, reset_at) VALUES (?, 1, ?)
+		ON CONFLICT(bucket_key) DO UPDATE SET
+			count = CASE WHEN rate_limit_buckets.reset_at < ? THEN 1 ELSE rate_limit_buckets.count + 1 END,
+			reset_at = CASE WHEN rate_limit_buckets.reset_at < ? THEN excluded.reset_at ELSE rate_limit_buckets.reset_at END
+		RETURNING bucket_key, count, reset_at`, key, now.Add(window), now, now).Scan(&bucket).Error
+	return bucket.Count, bucket.ResetAt, err
+}
+
+// RateLimitKey extracts what to count a request against (empty skips the limit)
+type RateLimitKey func(c *gin.Context) string
+
+// TrustProxies makes c.ClientIP() believe forwarding headers only when the
+// request comes from a trusted proxy (nginx on this host unless
+// TRUSTED_PROXIES lists others). Otherwise anyone could pick their own IP with
+// X-Forwarded-For, dodge the per-IP limits and forge the IP on sessions and
+// audit entries. nginx overwrites X-Real-IP, so it is preferred.
+func TrustProxies(r *gin.Engine) error {
+	proxies := []string{"127.0.0.1", "::1"}
+	if env := os.Getenv("TRUSTED_PROXIES"); env != "" {
+		proxies = strings.Split(env, ",")
+		for i := range proxies {
+			proxies[i] = strings.TrimSpace(proxies[i])
+		}
+	}
+	r.RemoteIPHeaders = []string{"X-Real-IP", "X-Forwarded-For"}
+	return r.SetTrustedProxies(proxies)
+}
+
+// ByIP counts requests per client address (see TrustProxies)
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByUser counts requests per signed-in account, for routes behind RequireAuth
+func ByUser(c *gin.Context) string {
+	userID, exists := c.Get("userID")
+	if !exists {
+		return ""
+	}
+	return fmt.Sprintf("user:%v", userID)
+}
+
+// ByEmail counts requests per "email" field in the JSON body, so one address
+// can't be targeted from many IPs. The body is restored for the handler.
+func ByEmail(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	c.Request.Body.Close()
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return ""
+	}
+
+	var body struct {
+		Email string `json:"email"`
+	}
+	if json.Unmarshal(data, &body) != nil || body.Email == "" {
+		return ""
+	}
+	return "email:" + strings.ToLower(strings.TrimSpace(body.Email))
+}
+
+// RateLimit allows limit requests per window for each key, answering 429
+// with Retry-After once it is exceeded. name separates counters of
+// different endpoints sharing a store. If the store fails the request is let
+// through, so a broken counter doesn't take the site down.
+func RateLimit(store RateLimitStore, name string, limit int, window time.Duration, key RateLimitKey) gin.HandlerFunc {
+	return rateLimit(store, name, limit, window, key, false)
+}
+
+// RateLimitStrict is RateLimit for sign-in and other credential checks, where
+// an unlimited window is worse than an outage: store errors answer 503.
+func RateLimitStrict(store RateLimitStore, name string, limit int, window time.Duration, key RateLimitKey) gin.HandlerFunc {
+	return rateLimit(store, name, limit, window, key, true)
+}
+
+func rateLimit(store RateLimitStore, name string, limit int, window time.Duration, key RateLimitKey, failClosed bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k := key(c)
+		if k == "" {
+			c.Next()
+			return
+		}
+
+		count, resetAt, err := store.Hit(name+":"+k, window)
+		if err != nil {
+			fmt.Printf("[RATELIMIT] store error for %s: %v\n", name, err)
+			if failClosed {
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Please try again in a moment."})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if count > limit {
+			retryAfter := int(math.Ceil(time.Until(resetAt).Seconds()))
+			c.Header("Retry-After", fmt.Sprint(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Too many requests. Please try again later.",
+				"retry_after": retryAfter,
+			})
+			return
+		}
+		c.Next()
+	}
+}
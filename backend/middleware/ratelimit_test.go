@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"checkmate-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newLimitedRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := TrustProxies(r); err != nil {
+		t.Fatal(err)
+	}
+	r.GET("/limited", RateLimit(NewMemoryStore(), "test", 2, time.Minute, ByIP), func(c *gin.Context) {
+		c.String(http.StatusOK, c.ClientIP())
+	})
+	return r
+}
+
+func hit(r *gin.Engine, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSpoofedForwardedForDoesNotResetLimit(t *testing.T) {
+	r := newLimitedRouter(t)
+	for i := 0; i < 3; i++ {
+		w := hit(r, "203.0.113.5:4000", map[string]string{"X-Forwarded-For": fmt.Sprintf("10.0.0.%d", i)})
+		if i < 2 && w.Code != http.StatusOK {
+			t.Fatalf("request %d: got %d, want 200", i, w.Code)
+		}
+		if i < 2 && w.Body.String() != "203.0.113.5" {
+			t.Fatalf("request %d: client IP %q taken from untrusted header", i, w.Body.String())
+		}
+		if i == 2 && w.Code != http.StatusTooManyRequests {
+			t.Fatalf("rotating X-Forwarded-For reset the limit: got %d, want 429", w.Code)
+		}
+	}
+}
+
+func TestTrustedProxyHeadersIdentifyClient(t *testing.T) {
+	r := newLimitedRouter(t)
+	for i := 0; i < 3; i++ {
+		// nginx sets X-Real-IP and appends the peer to whatever X-Forwarded-For the client sent
+		w := hit(r, "127.0.0.1:5000", map[string]string{
+			"X-Real-IP":       "198.51.100.7",
+			"X-Forwarded-For": fmt.Sprintf("10.0.0.%d, 198.51.100.7", i),
+		})
+		if i < 2 && w.Body.String() != "198.51.100.7" {
+			t.Fatalf("request %d: client IP %q, want 198.51.100.7", i, w.Body.String())
+		}
+		if i == 2 && w.Code != http.StatusTooManyRequests {
+			t.Fatalf("got %d, want 429", w.Code)
+		}
+	}
+
+	// A different real client behind the same proxy has its own bucket
+	w := hit(r, "127.0.0.1:5001", map[string]string{"X-Real-IP": "198.51.100.8"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("other client: got %d, want 200", w.Code)
+	}
+}
+
+// newTestDB opens a throwaway database file with the given tables migrated
+func newTestDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func newTestDBStore(t *testing.T) *DBStore {
+	t.Helper()
+	return &DBStore{DB: newTestDB(t, &models.RateLimitBucket{})}
+}
+
+func TestDBStoreCountsConcurrentHits(t *testing.T) {
+	store := newTestDBStore(t)
+
+	const hits = 100
+	counts := make([]int, hits)
+	errs := make([]error, hits)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < hits; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			counts[i], _, errs[i] = store.Hit("login:ip:203.0.113.5", time.Minute)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	seen := make(map[int]bool)
+	for i := range counts {
+		if errs[i] != nil {
+			t.Fatalf("hit %d: %v", i, errs[i])
+		}
+		if seen[counts[i]] {
+			t.Fatalf("count %d handed out twice, so a hit was lost", counts[i])
+		}
+		seen[counts[i]] = true
+	}
+	if count, _, _ := store.Hit("login:ip:203.0.113.5", time.Minute); count != hits+1 {
+		t.Fatalf("count = %d, want %d", count, hits+1)
+	}
+}
+
+func TestDBStoreStartsNewWindow(t *testing.T) {
+	store := newTestDBStore(t)
+	store.Hit("k", time.Minute)
+	store.Hit("k", time.Minute)
+	store.DB.Model(&models.RateLimitBucket{}).Where("bucket_key = ?", "k").Update("reset_at", time.Now().Add(-time.Second))
+
+	count, resetAt, err := store.Hit("k", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || time.Until(resetAt) < 50*time.Second {
+		t.Fatalf("count = %d, reset in %s; want a fresh one-minute window", count, time.Until(resetAt))
+	}
+}
+
+type brokenStore struct{}
+
+func (brokenStore) Hit(string, time.Duration) (int, time.Time, error) {
+	return 0, time.Time{}, errors.New("database is locked")
+}
+
+func TestStrictLimitFailsClosed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/lenient", RateLimit(brokenStore{}, "lenient", 1, time.Minute, ByIP), ok)
+	r.GET("/strict", RateLimitStrict(brokenStore{}, "strict", 1, time.Minute, ByIP), ok)
+
+	for path, want := range map[string]int{"/lenient": http.StatusOK, "/strict": http.StatusServiceUnavailable} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Fatalf("%s: status = %d, want %d", path, w.Code, want)
+		}
+	}
+}
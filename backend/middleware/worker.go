@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"checkmate-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RequireWorker authenticates remote processing agents by their bearer token
+func RequireWorker(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := c.GetHeader("Authorization")
+		if len(tokenString) > 7 && strings.ToUpper(tokenString[0:7]) == "BEARER " {
+			tokenString = tokenString[7:]
+		}
+		if tokenString == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Worker token required"})
+			return
+		}
+
+		sum := sha256.Sum256([]byte(tokenString))
+		var worker models.Worker
+		if err := db.Where("token_hash = ?", hex.EncodeToString(sum[:])).First(&worker).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid worker token"})
+			return
+		}
+		if worker.Disabled {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Worker has been disabled"})
+			return
+		}
+
+		db.Model(&worker).Update("last_seen_at", time.Now())
+
+		c.Set("workerID", worker.ID)
+		c.Next()
+	}
+}
@@ -1,29 +1,107 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	FirstName    string         `json:"first_name"`
-	LastName     string         `json:"last_name"`
-	Email        string         `gorm:"uniqueIndex" json:"email"`
-	PasswordHash string         `json:"-"`
-	IsAdmin      bool           `json:"is_admin"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	FirstName       string         `json:"first_name"`
+	LastName        string         `json:"last_name"`
+	Email           string         `gorm:"uniqueIndex" json:"email"`
+	EmailVerified   bool           `gorm:"default:false" json:"email_verified"` // Proved control of Email; needed to make purchases
+	PasswordHash    string         `json:"-"`
+	IsAdmin         bool           `json:"is_admin"` // Has at least one staff role (admin panel access)
+	TOTPSecret      string         `json:"-"`        // Base32; set during enrollment, active once TOTPEnabled
+	TOTPEnabled     bool           `json:"totp_enabled"`
+	TOTPLastStep    int64          `json:"-"`                  // Last accepted time step, so a code can't be replayed
+	FailedLogins    int            `gorm:"default:0" json:"-"` // Consecutive failures; reset on success
+	LockedUntil     *time.Time     `json:"locked_until,omitempty"`
+	SuspendedAt     *time.Time     `json:"suspended_at,omitempty"` // Set by staff; blocks sign-in and every API call
+	SuspendedReason string         `json:"suspended_reason,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
 
 	Credits UserCredits `gorm:"foreignKey:UserID" json:"credits"`
+	Roles   []Role      `gorm:"many2many:user_roles" json:"roles,omitempty"`
+}
+
+// Permissions granted by a user's roles (Roles must be preloaded)
+func (u *User) Permissions() []string {
+	seen := make(map[string]bool)
+	permissions := []string{}
+	for _, role := range u.Roles {
+		for _, permission := range role.Permissions {
+			if !seen[permission] {
+				seen[permission] = true
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	return permissions
+}
+
+// HasPermission reports whether any of the user's roles grants permission
+// (Roles must be preloaded)
+func (u *User) HasPermission(permission string) bool {
+	for _, role := range u.Roles {
+		for _, granted := range role.Permissions {
+			if granted == PermAll || granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Staff permissions, checked by middleware.RequirePermission
+const (
+	PermAll                = "*"
+	PermOrdersView         = "orders.view"    // See every order, its files and messages
+	PermOrdersProcess      = "orders.process" // Claim, process and complete orders
+	PermOrdersAssign       = "orders.assign"  // Reassign orders, operator stats
+	PermOrdersMessage      = "orders.message" // Reply to users in order threads
+	PermUsersView          = "users.view"
+	PermUsersManage        = "users.manage"      // Suspend accounts, send password resets
+	PermCreditsGrant       = "credits.grant"     // Add or remove slots by hand
+	PermUsersImpersonate   = "users.impersonate" // View the app as a customer (read-only unless superadmin)
+	PermTransactionsView   = "transactions.view"
+	PermTransactionsVerify = "transactions.verify"
+	PermPackagesManage     = "packages.manage"
+	PermWorkersManage      = "workers.manage"
+	PermRolesManage        = "roles.manage"
+	PermAuditView          = "audit.view"            // Read and export the audit log
+	PermNotifications      = "notifications.receive" // Staff push alerts
+)
+
+// AllPermissions lists every assignable permission
+var AllPermissions = []string{
+	PermOrdersView, PermOrdersProcess, PermOrdersAssign, PermOrdersMessage,
+	PermUsersView, PermUsersManage, PermUsersImpersonate, PermCreditsGrant, PermTransactionsView, PermTransactionsVerify,
+	PermPackagesManage, PermWorkersManage, PermRolesManage, PermAuditView, PermNotifications,
+}
+
+// Role is a named set of staff permissions. Built-in roles are seeded at
+// startup and cannot be edited or deleted.
+type Role struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"uniqueIndex;not null" json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `gorm:"serializer:json" json:"permissions"`
+	BuiltIn     bool      `json:"built_in"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 type VerificationCode struct {
 	ID        uint      `gorm:"primaryKey"`
 	Email     string    `gorm:"index"`
-	Code      string    `json:"code"`
+	CodeHash  string    `json:"-"`                         // HMAC of the emailed code, never the code itself
+	Attempts  int       `gorm:"default:0" json:"attempts"` // Wrong guesses; the code is discarded at the limit
 	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time
 }
@@ -31,7 +109,7 @@ type VerificationCode struct {
 type PasswordResetToken struct {
 	ID        uint      `gorm:"primaryKey"`
 	Email     string    `gorm:"index"`
-	Token     string    `gorm:"uniqueIndex"`
+	TokenHash string    `gorm:"uniqueIndex" json:"-"` // SHA-256 of the emailed token
 	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time
 }
@@ -42,6 +120,14 @@ const (
 	StatusPending    OrderStatus = "Pending"
 	StatusProcessing OrderStatus = "Processing"
 	StatusCompleted  OrderStatus = "Completed"
+	StatusFailed     OrderStatus = "Failed"
+)
+
+type OrderPriority int
+
+const (
+	PriorityStandard OrderPriority = 0
+	PriorityExpress  OrderPriority = 1
 )
 
 type Order struct {
@@ -51,20 +137,87 @@ type Order struct {
 	Status           OrderStatus `gorm:"default:'Pending'" json:"status"`
 	OriginalFilename string      `json:"original_filename"`
 	LocalFilePath    string      `json:"-"`
+	WordCount        int         `json:"word_count"` // Best-effort, 0 when the format can't be read
+
+	// Re-check of an earlier order (revised document)
+	PreviousOrderID *uint `gorm:"index" json:"previous_order_id"`
+	Version         int   `gorm:"default:1" json:"version"`
+
+	// Express orders jump ahead of standard ones in every queue
+	Priority OrderPriority `gorm:"default:0;index" json:"priority"`
 
 	User User `gorm:"foreignKey:UserID" json:"user"`
 
-	// Admin Added Fields
-	AIScore     int    `json:"ai_score"`
-	SimScore    int    `json:"sim_score"`
-	Report1Path string `json:"report1_path"`
-	Report2Path string `json:"report2_path"`
+	// Headline scores (details live in Reports)
+	AIScore  int `json:"ai_score"`
+	SimScore int `json:"sim_score"`
+
+	Reports []Report `gorm:"foreignKey:OrderID" json:"reports"`
+
+	// Issued on completion and printed on the summary certificate
+	VerificationCode *string `gorm:"uniqueIndex" json:"verification_code"`
+
+	// Admin Assignment (claims are leases that lapse if not renewed)
+	AssignedTo     *uint      `gorm:"index" json:"assigned_to"`
+	Assignee       *User      `gorm:"foreignKey:AssignedTo" json:"assignee,omitempty"`
+	ClaimedAt      *time.Time `json:"claimed_at"`
+	ClaimExpiresAt *time.Time `json:"claim_expires_at"`
+	CompletedBy    *uint      `gorm:"index" json:"completed_by"`
+
+	// Remote Worker Processing (lease shares ClaimedAt/ClaimExpiresAt)
+	WorkerID      *uint  `gorm:"index" json:"worker_id"`
+	Attempts      int    `json:"attempts"`
+	FailureReason string `json:"failure_reason"`
+
+	// SLA Tracking
+	DueAt       *time.Time `json:"due_at"`       // Promised turnaround deadline
+	CompletedAt *time.Time `json:"completed_at"` // When the order was marked completed
+	SLAMet      *bool      `json:"sla_met"`      // nil until completed
 
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+type ReportType string
+
+const (
+	ReportAI         ReportType = "ai"
+	ReportSimilarity ReportType = "similarity"
+	ReportSummary    ReportType = "summary" // Generated PDF certificate
+)
+
+// MatchedSource is an external source the document overlaps with
+type MatchedSource struct {
+	Source     string   `json:"source"`
+	URL        string   `json:"url,omitempty"`
+	Similarity int      `json:"similarity"`         // Percent of the document matching this source
+	Passages   []string `json:"passages,omitempty"` // Flagged passages attributed to the source
+}
+
+// ReportSection is the per-section breakdown of a report
+type ReportSection struct {
+	Title    string   `json:"title"`
+	Score    int      `json:"score"`
+	Passages []string `json:"passages,omitempty"` // Flagged passages within the section
+}
+
+// Report is one analysis result for an order; an order can have any number
+type Report struct {
+	ID             uint            `gorm:"primaryKey" json:"id"`
+	OrderID        uint            `gorm:"index" json:"order_id"`
+	Type           ReportType      `gorm:"index" json:"type"`
+	Score          *int            `json:"score"`
+	FilePath       string          `json:"file_path"` // Stored filename inside uploads/ (empty if no file)
+	FileName       string          `json:"file_name"` // Original filename shown to the user
+	SHA256         string          `json:"sha256"`    // Hex digest of the file, for public verification
+	MatchedSources []MatchedSource `gorm:"serializer:json" json:"matched_sources"`
+	Sections       []ReportSection `gorm:"serializer:json" json:"sections"`
+	GeneratedBy    string          `json:"generated_by"` // e.g. "admin:3", "worker:1", "migration"
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
 type PricingPackage struct {
 	ID             uint      `gorm:"primaryKey" json:"id"`
 	Name           string    `json:"name"`
@@ -123,3 +276,145 @@ type PushSubscription struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// Worker is a headless processing agent that leases orders through the worker API
+type Worker struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `json:"name"`
+	TokenHash  string     `gorm:"uniqueIndex" json:"-"` // SHA-256 of the bearer token
+	Disabled   bool       `json:"disabled"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// OrderMessage is one message in the per-order thread between a user and the admins
+type OrderMessage struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	OrderID        uint       `gorm:"index" json:"order_id"`
+	SenderID       uint       `json:"sender_id"`
+	FromAdmin      bool       `json:"from_admin"`
+	Body           string     `json:"body"`
+	AttachmentPath string     `json:"attachment_path"` // Stored filename inside uploads/
+	AttachmentName string     `json:"attachment_name"`
+	ReadAt         *time.Time `json:"read_at"` // When the other side first read it
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Session is one login on one device. Access tokens carry its ID so revoking
+// the session cuts them off immediately, and its refresh tokens stop working.
+type Session struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Device     string     `json:"device"` // e.g. "Chrome on Windows"
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"` // Slides forward with every refresh
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RefreshToken is a long-lived, single-use credential for minting new access
+// tokens. Each rotation revokes the old token; a replayed token revokes the
+// whole session it belongs to.
+type RefreshToken struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"index;not null" json:"user_id"`
+	SessionID    uint       `gorm:"index;not null" json:"session_id"`
+	TokenHash    string     `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	ReplacedByID *uint      `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// RecoveryCode is a single-use fallback for a lost authenticator. Only the
+// SHA-256 of the code is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RateLimitBucket is one fixed-window counter for the database rate limit store
+type RateLimitBucket struct {
+	Key     string    `gorm:"primaryKey;column:bucket_key"`
+	Count   int       `gorm:"not null"`
+	ResetAt time.Time `gorm:"index"`
+}
+
+// UserIdentity links a user to an account at an external identity provider,
+// matched on the provider's stable subject ID rather than the email address
+type UserIdentity struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Provider   string     `gorm:"uniqueIndex:idx_identity_subject;not null" json:"provider"` // e.g. "oidc:uon"
+	Subject    string     `gorm:"uniqueIndex:idx_identity_subject;not null" json:"-"`        // The IdP's "sub" claim
+	Email      string     `json:"email"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// OIDCLogin tracks one authorization-code round trip to an identity
+// provider. Once the callback succeeds it holds a short-lived, single-use
+// ticket the frontend exchanges for tokens.
+type OIDCLogin struct {
+	ID           uint      `gorm:"primaryKey"`
+	Provider     string    `gorm:"not null"`
+	StateHash    string    `gorm:"uniqueIndex;not null"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"` // PKCE
+	UserID       uint      // Set by the callback
+	LinkUserID   uint      // Set when a signed-in user is linking this provider
+	BrowserHash  string    // Hash of the cookie binding the flow to the browser that began it
+	TicketHash   string    `gorm:"index"`
+	ExpiresAt    time.Time `gorm:"index"`
+	CreatedAt    time.Time
+}
+
+// MagicLinkToken makes an emailed sign-in link single-use. The link carries
+// a signed JWT; only the hash of its ID is stored.
+type MagicLinkToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index;not null"`
+	JTIHash   string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// AuditLog records who did what to whom. Rows are only ever inserted: the
+// hooks below refuse updates and deletes.
+type AuditLog struct {
+	ID         uint                   `gorm:"primaryKey" json:"id"`
+	ActorID    uint                   `gorm:"index" json:"actor_id"`        // 0 for the system (webhooks, jobs)
+	Action     string                 `gorm:"index;not null" json:"action"` // e.g. "user.suspend"
+	TargetType string                 `gorm:"index:idx_audit_target" json:"target_type"`
+	TargetID   uint                   `gorm:"index:idx_audit_target" json:"target_id"`
+	Details    map[string]interface{} `gorm:"serializer:json" json:"details,omitempty"`
+	Changes    map[string]interface{} `gorm:"serializer:json" json:"changes,omitempty"` // field -> {"from", "to"}
+	IP         string                 `json:"ip"`
+	CreatedAt  time.Time              `gorm:"index" json:"created_at"`
+}
+
+// ErrAuditAppendOnly is returned when something tries to rewrite history
+var ErrAuditAppendOnly = errors.New("audit log entries cannot be changed or deleted")
+
+func (*AuditLog) BeforeUpdate(*gorm.DB) error { return ErrAuditAppendOnly }
+func (*AuditLog) BeforeDelete(*gorm.DB) error { return ErrAuditAppendOnly }
+
+// Impersonation lets a staff member see the app as a customer. Its token is
+// bound to the staff member's own session, expires on its own and can be
+// ended early; every request made with it is audited.
+type Impersonation struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	ActorID   uint       `gorm:"index;not null" json:"actor_id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	SessionID uint       `gorm:"not null" json:"-"` // The staff member's session
+	Reason    string     `json:"reason"`
+	ReadOnly  bool       `json:"read_only"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -8,6 +8,7 @@ import Login from './components/Login';
 import Register from './components/Register';
 import ForgotPassword from './components/ForgotPassword';
 import ResetPassword from './components/ResetPassword';
+import MagicLink from './components/MagicLink';
 import TermsOfService from './components/TermsOfService';
 import PrivacyPolicy from './components/PrivacyPolicy';
 import HelpCenter from './components/HelpCenter';
@@ -68,6 +69,13 @@ function App() {
                             <Footer />
                         </>
                     } />
+                    <Route path="/magic-link" element={
+                        <>
+                            <Header />
+                            <main><MagicLink /></main>
+                            <Footer />
+                        </>
+                    } />
                     <Route path="/terms" element={
                         <>
                             <Header />
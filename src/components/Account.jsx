@@ -1,10 +1,24 @@
 
 import React, { useState, useEffect } from 'react';
-import { auth } from '../services/api';
+import { GoogleLogin } from '@react-oauth/google';
+import { auth, identities as identitiesApi, profile as profileApi, sessions as sessionsApi, twoFactor } from '../services/api';
 
 const Account = () => {
     const [user, setUser] = useState({ firstName: '', lastName: '', email: '', is_admin: false });
     const [loading, setLoading] = useState(false);
+    const [sessions, setSessions] = useState([]);
+    const [twoFactorStatus, setTwoFactorStatus] = useState(null);
+    const [enrollment, setEnrollment] = useState(null);
+    const [twoFactorCode, setTwoFactorCode] = useState('');
+    const [recoveryCodes, setRecoveryCodes] = useState([]);
+    const [signInMethods, setSignInMethods] = useState(null);
+    const [ssoProviders, setSsoProviders] = useState([]);
+    const [ssoNames, setSsoNames] = useState({});
+    const [newPassword, setNewPassword] = useState('');
+    const [emailChange, setEmailChange] = useState({ email: '', password: '', currentCode: '', currentCodeSent: false, code: '', sent: false });
+    const [verification, setVerification] = useState({ code: '', sent: false });
+    const [passwordChange, setPasswordChange] = useState({ current: '', next: '' });
+    const [purchases, setPurchases] = useState(null);
 
     useEffect(() => {
         const storedUser = JSON.parse(localStorage.getItem('user') || '{}');
@@ -12,18 +26,220 @@ const Account = () => {
             firstName: storedUser.first_name || '',
             lastName: storedUser.last_name || '',
             email: storedUser.email || '',
+            emailVerified: storedUser.email_verified ?? true,
             is_admin: storedUser.is_admin || false
         });
+        profileApi.get().then((res) => rememberProfile(res.data)).catch(() => { });
+        profileApi.purchases().then((res) => setPurchases(res.data)).catch(() => { });
+        loadSessions();
+        loadTwoFactor();
+        loadSignInMethods();
+        auth.ssoProviders().then((res) => {
+            setSsoProviders(res.data || []);
+            setSsoNames(Object.fromEntries((res.data || []).map((p) => [`oidc:${p.id}`, p.name])));
+        }).catch(() => { });
+
+        // Returning from linking a provider: #sso_linked=... or #sso_error=...
+        const params = new URLSearchParams(window.location.hash.slice(1));
+        if (params.get('sso_linked') || params.get('sso_error')) {
+            window.history.replaceState(null, '', window.location.pathname);
+            alert(params.get('sso_error') || `${params.get('sso_linked')} linked`);
+        }
     }, []);
 
-    const handleUpdateProfile = (e) => {
+    const loadSignInMethods = () => {
+        identitiesApi.list().then((res) => setSignInMethods(res.data)).catch(() => { });
+    };
+
+    const providerName = (provider) => (provider === 'google' ? 'Google' : ssoNames[provider] || provider);
+
+    const handleLinkGoogle = async (credentialResponse) => {
+        try {
+            await identitiesApi.linkGoogle(credentialResponse.credential);
+            loadSignInMethods();
+        } catch (err) {
+            alert(err.response?.data?.error || "Failed to link Google");
+        }
+    };
+
+    const handleLinkSso = async (provider) => {
+        try {
+            const res = await identitiesApi.linkSso(provider.id);
+            window.location.href = res.data.url;
+        } catch (err) {
+            alert(err.response?.data?.error || `Failed to link ${provider.name}`);
+        }
+    };
+
+    const handleSetPassword = async (e) => {
         e.preventDefault();
-        // Placeholder for update API call
-        alert("Profile update feature coming soon!");
+        try {
+            const res = await identitiesApi.setPassword(newPassword);
+            setNewPassword('');
+            alert(res.data.message);
+            loadSignInMethods();
+        } catch (err) {
+            alert(err.response?.data?.error || "Failed to set password");
+        }
+    };
+
+    const handleUnlink = async (identity) => {
+        if (!window.confirm(`Stop signing in with ${providerName(identity.provider)}?`)) return;
+        try {
+            await identitiesApi.unlink(identity.id);
+            loadSignInMethods();
+        } catch (err) {
+            alert(err.response?.data?.error || "Failed to unlink");
+        }
+    };
+
+    const loadTwoFactor = () => {
+        twoFactor.status().then((res) => setTwoFactorStatus(res.data)).catch(() => { });
+    };
+
+    const handleStartTwoFactor = async () => {
+        try {
+            const res = await twoFactor.setup();
+            setEnrollment(res.data);
+            setRecoveryCodes([]);
+        } catch (err) {
+            alert(err.response?.data?.error || "Failed to start setup");
+        }
+    };
+
+    const handleTwoFactorAction = async (action) => {
+        try {
+            const res = await action(twoFactorCode);
+            setRecoveryCodes(res.data.recovery_codes || []);
+            setEnrollment(null);
+            setTwoFactorCode('');
+            loadTwoFactor();
+        } catch (err) {
+            alert(err.response?.data?.error || "Invalid code");
+        }
+    };
+
+    const loadSessions = () => {
+        sessionsApi.list().then((res) => setSessions(res.data || [])).catch(() => { });
     };
 
-    const handlePasswordReset = () => {
-        alert("Password reset email sent!");
+    const handleRevokeSession = async (session) => {
+        if (session.current) {
+            await auth.logout();
+            window.location.href = '/login';
+            return;
+        }
+        await sessionsApi.revoke(session.id).catch(() => { });
+        loadSessions();
+    };
+
+    // Keeps the cached user (shown in the sidebar) in step with the profile
+    const rememberProfile = (data) => {
+        const storedUser = JSON.parse(localStorage.getItem('user') || '{}');
+        localStorage.setItem('user', JSON.stringify({ ...storedUser, first_name: data.first_name, last_name: data.last_name, email: data.email, email_verified: data.email_verified }));
+        setUser((prev) => ({ ...prev, firstName: data.first_name, lastName: data.last_name, email: data.email, emailVerified: data.email_verified }));
+    };
+
+    const handleUpdateProfile = async (e) => {
+        e.preventDefault();
+        try {
+            const res = await profileApi.update({ first_name: user.firstName, last_name: user.lastName });
+            rememberProfile(res.data);
+            alert("Profile updated");
+        } catch (err) {
+            alert(err.response?.data?.error || "Failed to update profile");
+        }
+    };
+
+    const handleVerifyEmail = async (e) => {
+        e.preventDefault();
+        try {
+            if (!verification.sent) {
+                await profileApi.sendVerification();
+                setVerification({ code: '', sent: true });
+                return;
+            }
+            const res = await profileApi.confirmVerification(verification.code);
+            rememberProfile(res.data);
+            setVerification({ code: '', sent: false });
+            alert("Email address verified");
+        } catch (err) {
+            alert(err.response?.data?.error || "Failed to verify email");
+        }
+    };
+
+    const handleEmailChange = async (e) => {
+        e.preventDefault();
+        try {
+            if (!emailChange.sent) {
+                const res = await profileApi.requestEmailChange(emailChange.email, emailChange.password, emailChange.currentCode);
+                if (res.data.current_code_required) {
+                    setEmailChange({ ...emailChange, currentCodeSent: true });
+                    alert(res.data.message);
+                    return;
+                }
+                setEmailChange({ ...emailChange, password: '', currentCode: '', currentCodeSent: false, sent: true });
+                return;
+            }
+            const res = await profileApi.confirmEmailChange(emailChange.email, emailChange.code);
+            rememberProfile(res.data);
+            setEmailChange({ email: '', password: '', currentCode: '', currentCodeSent: false, code: '', sent: false });
+            loadSessions();
+            alert("Email address updated. Other devices have been signed out.");
+        } catch (err) {
+            alert(err.response?.data?.error || "Failed to change email");
+        }
+    };
+
+    const handleExport = async () => {
+        try {
+            const response = await profileApi.exportData();
+            const url = window.URL.createObjectURL(new Blob([response.data]));
+            const link = document.createElement('a');
+            link.href = url;
+            link.setAttribute('download', 'checkmate-export.zip');
+            document.body.appendChild(link);
+            link.click();
+            link.parentNode.removeChild(link);
+            window.URL.revokeObjectURL(url);
+        } catch (err) {
+            alert("Failed to export your data");
+        }
+    };
+
+    const handleDeleteAccount = async () => {
+        const confirm = window.prompt(`This permanently deletes your account, documents and reports. Payment records are kept as required by law.\n\nType your email (${user.email}) to confirm:`);
+        if (!confirm) return;
+        let password = '';
+        if (signInMethods?.has_password) {
+            password = window.prompt("Enter your password:");
+            if (!password) return;
+        }
+        try {
+            await profileApi.deleteAccount(confirm, password);
+            await auth.logout();
+            window.location.href = '/';
+        } catch (err) {
+            alert(err.response?.data?.error || "Failed to delete account");
+        }
+    };
+
+    const handleChangePassword = async (e) => {
+        e.preventDefault();
+        try {
+            const res = await profileApi.changePassword(passwordChange.current, passwordChange.next);
+            setPasswordChange({ current: '', next: '' });
+            alert(res.data.message);
+            loadSessions();
+        } catch (err) {
+            alert(err.response?.data?.error || "Failed to change password");
+        }
+    };
+
+    const handleLogoutAll = async () => {
+        if (!window.confirm("Sign out of Checkmate on every device, including this one?")) return;
+        await auth.logoutAll().catch(() => { });
+        window.location.href = '/login';
     };
 
     return (
@@ -63,23 +279,298 @@ const Account = () => {
                             Update Profile
                         </button>
                     </form>
-                    <button className="btn" style={{ width: '100%', marginTop: '10px', background: '#dc3545', color: 'white', border: 'none' }}>
+
+                    {!user.emailVerified && (
+                        <form onSubmit={handleVerifyEmail} style={{ marginTop: '24px', padding: '12px', background: '#fff3cd', borderRadius: '6px' }}>
+                            <p style={{ margin: '0 0 10px' }}>{user.email} is not verified yet. Verify it to buy slots.</p>
+                            {verification.sent && (
+                                <div className="form-group">
+                                    <input
+                                        type="text"
+                                        className="form-control"
+                                        placeholder={`Code sent to ${user.email}`}
+                                        autoComplete="one-time-code"
+                                        value={verification.code}
+                                        onChange={(e) => setVerification({ ...verification, code: e.target.value })}
+                                        required
+                                    />
+                                </div>
+                            )}
+                            <button type="submit" className="btn btn-primary" style={{ width: '100%' }}>
+                                {verification.sent ? 'Verify Email' : 'Send Verification Code'}
+                            </button>
+                        </form>
+                    )}
+
+                    <form onSubmit={handleEmailChange} style={{ marginTop: '24px' }}>
+                        <div className="form-group">
+                            <label>Email Address</label>
+                            <p className="text-muted" style={{ fontSize: '0.85rem' }}>Currently {user.email}</p>
+                            <input
+                                type="email"
+                                className="form-control"
+                                placeholder="New email address"
+                                value={emailChange.email}
+                                onChange={(e) => setEmailChange({ ...emailChange, email: e.target.value, sent: false })}
+                                required
+                            />
+                        </div>
+                        {!emailChange.sent && signInMethods?.has_password && (
+                            <div className="form-group">
+                                <input
+                                    type="password"
+                                    className="form-control"
+                                    placeholder="Current password"
+                                    autoComplete="current-password"
+                                    value={emailChange.password}
+                                    onChange={(e) => setEmailChange({ ...emailChange, password: e.target.value })}
+                                    required
+                                />
+                            </div>
+                        )}
+                        {!emailChange.sent && emailChange.currentCodeSent && (
+                            <div className="form-group">
+                                <input
+                                    type="text"
+                                    className="form-control"
+                                    placeholder={`Code sent to ${user.email}`}
+                                    autoComplete="one-time-code"
+                                    value={emailChange.currentCode}
+                                    onChange={(e) => setEmailChange({ ...emailChange, currentCode: e.target.value })}
+                                    required
+                                />
+                            </div>
+                        )}
+                        {emailChange.sent && (
+                            <div className="form-group">
+                                <input
+                                    type="text"
+                                    className="form-control"
+                                    placeholder="Code sent to the new address"
+                                    autoComplete="one-time-code"
+                                    value={emailChange.code}
+                                    onChange={(e) => setEmailChange({ ...emailChange, code: e.target.value })}
+                                    required
+                                />
+                            </div>
+                        )}
+                        <button type="submit" className="btn" style={{ width: '100%', background: '#6c757d', color: 'white' }}>
+                            {emailChange.sent ? 'Confirm New Email' : 'Send Verification Code'}
+                        </button>
+                    </form>
+                    <button onClick={handleExport} className="btn" style={{ width: '100%', marginTop: '24px', background: '#6c757d', color: 'white' }}>
+                        Download My Data
+                    </button>
+                    <button onClick={handleDeleteAccount} className="btn" style={{ width: '100%', marginTop: '10px', background: '#dc3545', color: 'white', border: 'none' }}>
                         Delete Account
                     </button>
                 </div>
 
                 <div style={{ display: 'flex', flexDirection: 'column', gap: '20px' }}>
                     {/* Change Password Card */}
+                    {signInMethods?.has_password && (
+                        <div className="stat-card" style={{ padding: '24px' }}>
+                            <h3>Change Password</h3>
+                            <p className="text-muted" style={{ marginBottom: '20px' }}>
+                                Other devices will be signed out.
+                            </p>
+                            <form onSubmit={handleChangePassword}>
+                                <input
+                                    type="password"
+                                    className="form-control"
+                                    placeholder="Current password"
+                                    autoComplete="current-password"
+                                    value={passwordChange.current}
+                                    onChange={(e) => setPasswordChange({ ...passwordChange, current: e.target.value })}
+                                    style={{ marginBottom: '10px' }}
+                                    required
+                                />
+                                <input
+                                    type="password"
+                                    className="form-control"
+                                    placeholder="New password"
+                                    autoComplete="new-password"
+                                    value={passwordChange.next}
+                                    onChange={(e) => setPasswordChange({ ...passwordChange, next: e.target.value })}
+                                    style={{ marginBottom: '10px' }}
+                                    required
+                                />
+                                <button type="submit" className="btn" style={{ width: '100%', background: '#6c757d', color: 'white' }}>
+                                    Change Password
+                                </button>
+                            </form>
+                        </div>
+                    )}
+
+                    {/* Sign-in Methods Card */}
+                    {signInMethods && (
+                        <div className="stat-card" style={{ padding: '24px' }}>
+                            <h3>Sign-in Methods</h3>
+                            <p className="text-muted" style={{ marginBottom: '20px' }}>
+                                Ways you can sign in to this account.
+                            </p>
+                            <div style={{ padding: '10px 0', borderBottom: '1px solid #e5e7eb', fontWeight: 600 }}>
+                                Email &amp; password{!signInMethods.has_password && <span className="text-muted"> (not set)</span>}
+                            </div>
+                            {signInMethods.identities.map((identity) => (
+                                <div key={identity.id} style={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center', padding: '10px 0', borderBottom: '1px solid #e5e7eb' }}>
+                                    <div>
+                                        <div style={{ fontWeight: 600 }}>{providerName(identity.provider)}</div>
+                                        <div className="text-muted" style={{ fontSize: '0.85rem' }}>{identity.email}</div>
+                                    </div>
+                                    <button onClick={() => handleUnlink(identity)} className="btn" style={{ background: 'transparent', color: '#dc3545', border: '1px solid #dc3545' }}>
+                                        Unlink
+                                    </button>
+                                </div>
+                            ))}
+
+                            {!signInMethods.has_password && (
+                                <form onSubmit={handleSetPassword} style={{ marginTop: '16px' }}>
+                                    <input
+                                        type="password"
+                                        className="form-control"
+                                        placeholder="Choose a password"
+                                        autoComplete="new-password"
+                                        value={newPassword}
+                                        onChange={(e) => setNewPassword(e.target.value)}
+                                        style={{ marginBottom: '10px' }}
+                                        required
+                                    />
+                                    <button type="submit" className="btn btn-primary" style={{ width: '100%' }}>
+                                        Add Password
+                                    </button>
+                                </form>
+                            )}
+                            {!signInMethods.identities.some((identity) => identity.provider === 'google') && (
+                                <div style={{ display: 'flex', justifyContent: 'center', marginTop: '16px' }}>
+                                    <GoogleLogin
+                                        onSuccess={handleLinkGoogle}
+                                        onError={() => alert('Google Sign-In Failed')}
+                                        text="continue_with"
+                                        theme="outline"
+                                    />
+                                </div>
+                            )}
+                            {ssoProviders
+                                .filter((provider) => !signInMethods.identities.some((identity) => identity.provider === `oidc:${provider.id}`))
+                                .map((provider) => (
+                                    <button key={provider.id} onClick={() => handleLinkSso(provider)} className="btn" style={{ width: '100%', marginTop: '10px', border: '1px solid #d1d5db' }}>
+                                        Link {provider.name}
+                                    </button>
+                                ))}
+                        </div>
+                    )}
+
+                    {/* Two-Factor Card */}
                     <div className="stat-card" style={{ padding: '24px' }}>
-                        <h3>Change Password</h3>
+                        <h3>Two-Factor Authentication</h3>
+                        {twoFactorStatus?.required && !twoFactorStatus?.enabled && (
+                            <div className="error-message" style={{ marginTop: '12px' }}>
+                                Staff accounts must enable two-factor authentication before using the admin panel.
+                            </div>
+                        )}
                         <p className="text-muted" style={{ marginBottom: '20px' }}>
-                            Receive an email to rest your password securely.
+                            {twoFactorStatus?.enabled
+                                ? `Enabled. ${twoFactorStatus.recovery_codes_remaining} recovery codes left.`
+                                : 'Protect your account with a code from an authenticator app.'}
                         </p>
-                        <button onClick={handlePasswordReset} className="btn" style={{ width: '100%', background: '#6c757d', color: 'white' }}>
-                            Send Password Reset Email
+
+                        {enrollment && (
+                            <div style={{ marginBottom: '16px' }}>
+                                <p>Add this key to your authenticator app, or <a href={enrollment.provisioning_uri}>open it on this device</a>:</p>
+                                <code style={{ display: 'block', padding: '10px', background: '#f1f5f9', borderRadius: '6px', wordBreak: 'break-all' }}>{enrollment.secret}</code>
+                            </div>
+                        )}
+
+                        {recoveryCodes.length > 0 && (
+                            <div style={{ marginBottom: '16px' }}>
+                                <p><strong>Save these recovery codes.</strong> Each works once if you lose your device; they won't be shown again.</p>
+                                <code style={{ display: 'block', padding: '10px', background: '#f1f5f9', borderRadius: '6px', whiteSpace: 'pre' }}>{recoveryCodes.join('\n')}</code>
+                            </div>
+                        )}
+
+                        {(enrollment || twoFactorStatus?.enabled) && (
+                            <input
+                                type="text"
+                                className="form-control"
+                                placeholder="Authentication code"
+                                autoComplete="one-time-code"
+                                value={twoFactorCode}
+                                onChange={(e) => setTwoFactorCode(e.target.value)}
+                                style={{ marginBottom: '10px' }}
+                            />
+                        )}
+
+                        {!twoFactorStatus?.enabled && !enrollment && (
+                            <button onClick={handleStartTwoFactor} className="btn btn-primary" style={{ width: '100%' }}>
+                                Set Up Two-Factor
+                            </button>
+                        )}
+                        {enrollment && (
+                            <button onClick={() => handleTwoFactorAction(twoFactor.enable)} className="btn btn-primary" style={{ width: '100%' }}>
+                                Verify &amp; Enable
+                            </button>
+                        )}
+                        {twoFactorStatus?.enabled && (
+                            <div style={{ display: 'flex', gap: '10px' }}>
+                                <button onClick={() => handleTwoFactorAction(twoFactor.regenerateRecoveryCodes)} className="btn" style={{ flex: 1, background: '#6c757d', color: 'white' }}>
+                                    New Recovery Codes
+                                </button>
+                                {!twoFactorStatus.required && (
+                                    <button onClick={() => handleTwoFactorAction(twoFactor.disable)} className="btn" style={{ flex: 1, background: '#dc3545', color: 'white', border: 'none' }}>
+                                        Disable
+                                    </button>
+                                )}
+                            </div>
+                        )}
+                    </div>
+
+                    {/* Sessions Card */}
+                    <div className="stat-card" style={{ padding: '24px' }}>
+                        <h3>Sessions</h3>
+                        <p className="text-muted" style={{ marginBottom: '20px' }}>
+                            Devices currently signed in to your account.
+                        </p>
+                        {sessions.map((session) => (
+                            <div key={session.id} style={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center', padding: '10px 0', borderBottom: '1px solid #e5e7eb' }}>
+                                <div>
+                                    <div style={{ fontWeight: 600 }}>
+                                        {session.device}{session.current && <span className="text-muted"> (this device)</span>}
+                                    </div>
+                                    <div className="text-muted" style={{ fontSize: '0.85rem' }}>
+                                        {session.ip} · last active {new Date(session.last_seen_at).toLocaleString()}
+                                    </div>
+                                </div>
+                                <button onClick={() => handleRevokeSession(session)} className="btn" style={{ background: 'transparent', color: '#dc3545', border: '1px solid #dc3545' }}>
+                                    Sign out
+                                </button>
+                            </div>
+                        ))}
+                        <button onClick={handleLogoutAll} className="btn" style={{ width: '100%', marginTop: '16px', background: '#6c757d', color: 'white' }}>
+                            Sign Out Everywhere
                         </button>
                     </div>
 
+                    {/* Purchase History Card */}
+                    {purchases && (
+                        <div className="stat-card" style={{ padding: '24px' }}>
+                            <h3>Purchase History</h3>
+                            <p className="text-muted" style={{ marginBottom: '20px' }}>
+                                {purchases.total_slots} slots bought for KSH {purchases.total_spent.toLocaleString()}
+                            </p>
+                            {purchases.purchases.length === 0 && <p className="text-muted">No purchases yet.</p>}
+                            {purchases.purchases.map((purchase) => (
+                                <div key={purchase.id} style={{ display: 'flex', justifyContent: 'space-between', padding: '10px 0', borderBottom: '1px solid #e5e7eb' }}>
+                                    <div>
+                                        <div style={{ fontWeight: 600 }}>{purchase.slots_purchased} slot{purchase.slots_purchased === 1 ? '' : 's'} · KSH {purchase.amount}</div>
+                                        <div className="text-muted" style={{ fontSize: '0.85rem' }}>{new Date(purchase.created_at).toLocaleString()}</div>
+                                    </div>
+                                    <span className="text-muted" style={{ textTransform: 'capitalize' }}>{purchase.status}</span>
+                                </div>
+                            ))}
+                        </div>
+                    )}
+
                     {/* Subscription Status Card */}
                     <div className="stat-card" style={{ padding: '24px' }}>
                         <h3>Subscription Status</h3>
@@ -1,56 +1,300 @@
 import React, { useState, useEffect } from 'react';
-import { admin } from '../services/api';
+import { admin, can } from '../services/api';
+
+const PAGE_SIZE = 25;
+
+const thStyle = { padding: '16px 24px', textAlign: 'left', color: '#64748b', fontWeight: '600', textTransform: 'uppercase', fontSize: '0.75rem', letterSpacing: '0.05em' };
+const tdStyle = { padding: '20px 24px', verticalAlign: 'middle' };
+const smallBtn = { marginLeft: '8px', padding: '2px 10px', fontSize: '0.8rem' };
 
 const AdminUsers = () => {
     const [users, setUsers] = useState([]);
+    const [total, setTotal] = useState(0);
+    const [page, setPage] = useState(1);
+    const [search, setSearch] = useState('');
+    const [query, setQuery] = useState('');
+    const [roleFilter, setRoleFilter] = useState('');
+    const [statusFilter, setStatusFilter] = useState('');
+    const [roles, setRoles] = useState([]);
+    const [selected, setSelected] = useState(null);
+    const canManageRoles = can('roles.manage');
+    const canManageUsers = can('users.manage');
+    const canGrantCredits = can('credits.grant');
+    const canImpersonate = can('users.impersonate');
+
+    const fetchUsers = async () => {
+        try {
+            const response = await admin.listUsers({ q: query, role: roleFilter, status: statusFilter, page, page_size: PAGE_SIZE });
+            setUsers(response.data.users || []);
+            setTotal(response.data.total || 0);
+        } catch (error) {
+            console.error("Failed to fetch users", error);
+        }
+    };
+
+    const fetchDetails = async (id) => {
+        try {
+            const response = await admin.getUser(id);
+            setSelected(response.data);
+        } catch (error) {
+            alert(error.response?.data?.error || "Failed to load user");
+        }
+    };
 
     useEffect(() => {
-        const fetchUsers = async () => {
+        fetchUsers();
+    }, [query, roleFilter, statusFilter, page]);
+
+    useEffect(() => {
+        if (canManageRoles) {
+            admin.listRoles().then((res) => setRoles(res.data.roles || [])).catch(() => { });
+        }
+    }, []);
+
+    // Refresh the list and the open detail panel after an action
+    const refresh = (user) => {
+        fetchUsers();
+        if (selected && selected.user.id === user.id) fetchDetails(user.id);
+    };
+
+    const handleSearch = (e) => {
+        e.preventDefault();
+        setPage(1);
+        setQuery(search.trim());
+    };
+
+    const handleEditRoles = async (user) => {
+        const current = (user.roles || []).map((r) => r.name).join(', ');
+        const input = window.prompt(
+            `Roles for ${user.email} (comma separated, empty for none).\nAvailable: ${roles.map((r) => r.name).join(', ')}`,
+            current
+        );
+        if (input === null) return;
+        const names = input.split(',').map((n) => n.trim()).filter(Boolean);
+        try {
+            await admin.setUserRoles(user.id, names);
+            refresh(user);
+        } catch (error) {
+            alert(error.response?.data?.error || "Failed to update roles");
+        }
+    };
+
+    const handleSuspend = async (user) => {
+        if (user.suspended_at) {
+            if (!window.confirm(`Allow ${user.email} to sign in again?`)) return;
             try {
-                const response = await admin.listUsers();
-                setUsers(response.data);
+                await admin.unsuspendUser(user.id);
+                refresh(user);
             } catch (error) {
-                console.error("Failed to fetch users", error);
+                alert(error.response?.data?.error || "Failed to unsuspend user");
             }
-        };
-        fetchUsers();
-    }, []);
+            return;
+        }
+        const reason = window.prompt(`Suspend ${user.email}? They will be signed out everywhere.\nReason:`);
+        if (!reason) return;
+        try {
+            await admin.suspendUser(user.id, reason);
+            refresh(user);
+        } catch (error) {
+            alert(error.response?.data?.error || "Failed to suspend user");
+        }
+    };
+
+    const handleAdjustSlots = async (user) => {
+        const input = window.prompt(`Slots to add for ${user.email} (use a negative number to remove):`);
+        if (input === null) return;
+        const delta = parseInt(input, 10);
+        if (!delta) {
+            alert("Enter a whole number other than 0");
+            return;
+        }
+        const reason = window.prompt("Reason (recorded in the audit log):");
+        if (!reason) return;
+        try {
+            await admin.adjustSlots(user.id, delta, reason);
+            refresh(user);
+        } catch (error) {
+            alert(error.response?.data?.error || "Failed to update slots");
+        }
+    };
+
+    const handlePasswordReset = async (user) => {
+        if (!window.confirm(`Email a password reset link to ${user.email}?`)) return;
+        try {
+            const response = await admin.sendPasswordReset(user.id);
+            alert(response.data.message);
+            refresh(user);
+        } catch (error) {
+            alert(error.response?.data?.error || "Failed to send reset link");
+        }
+    };
+
+    const handleImpersonate = async (user) => {
+        const reason = window.prompt(`View the app as ${user.email}? This is logged.\nReason (e.g. ticket number):`);
+        if (!reason) return;
+        // Superadmins may act as the user; everyone else gets a read-only view
+        const write = can('*') && window.confirm("Allow changes while impersonating? Cancel for read-only.");
+        try {
+            await admin.impersonate(user.id, reason, write);
+            window.location.href = '/dashboard';
+        } catch (error) {
+            alert(error.response?.data?.error || "Failed to impersonate user");
+        }
+    };
+
+    const totalPages = Math.max(1, Math.ceil(total / PAGE_SIZE));
 
     return (
         <div className="dashboard-container">
             <h2 className="dashboard-title">User Management</h2>
+
+            <form onSubmit={handleSearch} style={{ display: 'flex', gap: '8px', flexWrap: 'wrap', marginBottom: '16px' }}>
+                <input
+                    type="text"
+                    className="form-control"
+                    placeholder="Search name or email"
+                    value={search}
+                    onChange={(e) => setSearch(e.target.value)}
+                    style={{ flex: '1 1 240px', padding: '8px 12px', borderRadius: '6px', border: '1px solid #cbd5e1' }}
+                />
+                <select className="form-control" value={roleFilter} onChange={(e) => { setPage(1); setRoleFilter(e.target.value); }} style={{ padding: '8px', borderRadius: '6px', border: '1px solid #cbd5e1' }}>
+                    <option value="">All roles</option>
+                    <option value="none">Customers</option>
+                    {roles.map((r) => <option key={r.id} value={r.name}>{r.name}</option>)}
+                </select>
+                <select className="form-control" value={statusFilter} onChange={(e) => { setPage(1); setStatusFilter(e.target.value); }} style={{ padding: '8px', borderRadius: '6px', border: '1px solid #cbd5e1' }}>
+                    <option value="">Any status</option>
+                    <option value="active">Active</option>
+                    <option value="suspended">Suspended</option>
+                    <option value="locked">Locked out</option>
+                    <option value="unverified">Unverified email</option>
+                </select>
+                <button type="submit" className="btn btn-primary">Search</button>
+            </form>
+
+            {selected && (
+                <div className="card" style={{ marginBottom: '16px', padding: '20px' }}>
+                    <div style={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center' }}>
+                        <h3 style={{ margin: 0 }}>{selected.user.first_name} {selected.user.last_name} · {selected.user.email}</h3>
+                        <button className="btn" onClick={() => setSelected(null)}>Close</button>
+                    </div>
+                    <p style={{ color: '#64748b' }}>
+                        Joined {new Date(selected.user.created_at).toLocaleDateString()} · {selected.has_password ? 'Has password' : 'No password'} · {selected.active_sessions} active session(s)
+                        {selected.user.suspended_at && <> · <strong style={{ color: '#dc2626' }}>Suspended: {selected.user.suspended_reason}</strong></>}
+                    </p>
+
+                    <h4>Orders</h4>
+                    {selected.orders.length === 0 ? <p style={{ color: '#64748b' }}>No orders.</p> : (
+                        <ul>
+                            {selected.orders.map((o) => (
+                                <li key={o.id}>#{o.id} {o.original_filename} — {o.status} ({new Date(o.created_at).toLocaleDateString()})</li>
+                            ))}
+                        </ul>
+                    )}
+
+                    <h4>Transactions</h4>
+                    {selected.transactions.length === 0 ? <p style={{ color: '#64748b' }}>No transactions.</p> : (
+                        <ul>
+                            {selected.transactions.map((t) => (
+                                <li key={t.id}>{t.payment_reference} — {t.amount} for {t.slots_purchased} slot(s), {t.status} ({new Date(t.created_at).toLocaleDateString()})</li>
+                            ))}
+                        </ul>
+                    )}
+
+                    <h4>Staff Actions</h4>
+                    {selected.audit.length === 0 ? <p style={{ color: '#64748b' }}>None recorded.</p> : (
+                        <ul>
+                            {selected.audit.map((a) => (
+                                <li key={a.id}>{new Date(a.created_at).toLocaleString()} — {a.action} by #{a.actor_id} {a.changes && <code>{JSON.stringify(a.changes)}</code>} {a.details && <code>{JSON.stringify(a.details)}</code>}</li>
+                            ))}
+                        </ul>
+                    )}
+                </div>
+            )}
+
             <div className="card" style={{ overflow: 'hidden', border: 'none', boxShadow: '0 4px 6px -1px rgba(0, 0, 0, 0.1), 0 2px 4px -1px rgba(0, 0, 0, 0.06)' }}>
                 <div className="table-responsive">
                     <table className="table" style={{ width: '100%', borderCollapse: 'separate', borderSpacing: '0' }}>
                         <thead style={{ background: '#f8fafc' }}>
                             <tr>
-                                <th style={{ padding: '16px 24px', textAlign: 'left', color: '#64748b', fontWeight: '600', textTransform: 'uppercase', fontSize: '0.75rem', letterSpacing: '0.05em' }}>ID</th>
-                                <th style={{ padding: '16px 24px', textAlign: 'left', color: '#64748b', fontWeight: '600', textTransform: 'uppercase', fontSize: '0.75rem', letterSpacing: '0.05em' }}>First Name</th>
-                                <th style={{ padding: '16px 24px', textAlign: 'left', color: '#64748b', fontWeight: '600', textTransform: 'uppercase', fontSize: '0.75rem', letterSpacing: '0.05em' }}>Last Name</th>
-                                <th style={{ padding: '16px 24px', textAlign: 'left', color: '#64748b', fontWeight: '600', textTransform: 'uppercase', fontSize: '0.75rem', letterSpacing: '0.05em' }}>Email</th>
-                                <th style={{ padding: '16px 24px', textAlign: 'left', color: '#64748b', fontWeight: '600', textTransform: 'uppercase', fontSize: '0.75rem', letterSpacing: '0.05em' }}>Active Slots</th>
-                                <th style={{ padding: '16px 24px', textAlign: 'left', color: '#64748b', fontWeight: '600', textTransform: 'uppercase', fontSize: '0.75rem', letterSpacing: '0.05em' }}>Total Purchased</th>
+                                <th style={thStyle}>ID</th>
+                                <th style={thStyle}>First Name</th>
+                                <th style={thStyle}>Last Name</th>
+                                <th style={thStyle}>Email</th>
+                                <th style={thStyle}>Active Slots</th>
+                                <th style={thStyle}>Total Purchased</th>
+                                <th style={thStyle}>Roles</th>
+                                <th style={thStyle}>Actions</th>
                             </tr>
                         </thead>
                         <tbody>
                             {users.map((user, index) => (
                                 <tr key={user.id} style={{ borderBottom: index !== users.length - 1 ? '1px solid #f1f5f9' : 'none' }}>
-                                    <td style={{ padding: '20px 24px', verticalAlign: 'middle', color: '#64748b' }}>{user.id}</td>
-                                    <td style={{ padding: '20px 24px', verticalAlign: 'middle', fontWeight: '600', color: '#0f172a' }}>{user.first_name}</td>
-                                    <td style={{ padding: '20px 24px', verticalAlign: 'middle', fontWeight: '600', color: '#0f172a' }}>{user.last_name}</td>
-                                    <td style={{ padding: '20px 24px', verticalAlign: 'middle', color: '#334155' }}>{user.email}</td>
-                                    <td style={{ padding: '20px 24px', verticalAlign: 'middle' }}>
+                                    <td style={{ ...tdStyle, color: '#64748b' }}>{user.id}</td>
+                                    <td style={{ ...tdStyle, fontWeight: '600', color: '#0f172a' }}>{user.first_name}</td>
+                                    <td style={{ ...tdStyle, fontWeight: '600', color: '#0f172a' }}>{user.last_name}</td>
+                                    <td style={{ ...tdStyle, color: '#334155' }}>
+                                        {user.email}
+                                        {user.suspended_at && (
+                                            <span title={user.suspended_reason} style={{ marginLeft: '8px', background: '#fee2e2', color: '#dc2626', padding: '2px 8px', borderRadius: '12px', fontSize: '0.75rem', fontWeight: '600' }}>
+                                                Suspended
+                                            </span>
+                                        )}
+                                    </td>
+                                    <td style={tdStyle}>
                                         <span style={{ background: '#dcfce7', color: '#16a34a', padding: '4px 10px', borderRadius: '12px', fontSize: '0.85rem', fontWeight: '600' }}>
                                             {user.credits?.slots_remaining || 0}
                                         </span>
+                                        {canGrantCredits && (
+                                            <button onClick={() => handleAdjustSlots(user)} className="btn" style={smallBtn}>
+                                                Adjust
+                                            </button>
+                                        )}
+                                    </td>
+                                    <td style={{ ...tdStyle, color: '#64748b' }}>{user.credits?.total_purchased || 0}</td>
+                                    <td style={{ ...tdStyle, color: '#334155' }}>
+                                        {(user.roles || []).map((r) => r.name).join(', ') || '—'}
+                                        {canManageRoles && (
+                                            <button onClick={() => handleEditRoles(user)} className="btn" style={smallBtn}>
+                                                Edit
+                                            </button>
+                                        )}
+                                    </td>
+                                    <td style={{ ...tdStyle, whiteSpace: 'nowrap' }}>
+                                        <button onClick={() => fetchDetails(user.id)} className="btn" style={{ ...smallBtn, marginLeft: 0 }}>
+                                            View
+                                        </button>
+                                        {canImpersonate && !(user.roles || []).length && (
+                                            <button onClick={() => handleImpersonate(user)} className="btn" style={smallBtn}>
+                                                View As
+                                            </button>
+                                        )}
+                                        {canManageUsers && (
+                                            <>
+                                                <button onClick={() => handleSuspend(user)} className="btn" style={smallBtn}>
+                                                    {user.suspended_at ? 'Unsuspend' : 'Suspend'}
+                                                </button>
+                                                <button onClick={() => handlePasswordReset(user)} className="btn" style={smallBtn}>
+                                                    Reset Password
+                                                </button>
+                                            </>
+                                        )}
                                     </td>
-                                    <td style={{ padding: '20px 24px', verticalAlign: 'middle', color: '#64748b' }}>{user.credits?.total_purchased || 0}</td>
                                 </tr>
                             ))}
                         </tbody>
                     </table>
                 </div>
             </div>
+
+            <div style={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center', marginTop: '16px', color: '#64748b' }}>
+                <span>{total} user(s)</span>
+                <div style={{ display: 'flex', gap: '8px', alignItems: 'center' }}>
+                    <button className="btn" disabled={page <= 1} onClick={() => setPage(page - 1)}>Previous</button>
+                    <span>Page {page} of {totalPages}</span>
+                    <button className="btn" disabled={page >= totalPages} onClick={() => setPage(page + 1)}>Next</button>
+                </div>
+            </div>
         </div>
     );
 };
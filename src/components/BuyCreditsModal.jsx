@@ -58,7 +58,7 @@ const BuyCreditsModal = ({ isOpen, onClose, onSuccess, preSelectedPackage = null
         } catch (err) {
             setIsProcessing(false);
             const msg = err.response?.data?.error || err.response?.data?.message || err.message || 'Failed to initiate payment.';
-            setError(msg);
+            setError(err.response?.data?.verification_required ? `${msg} under Account settings.` : msg);
         }
     };
 
@@ -110,6 +110,12 @@ const Dashboard = () => {
         return status === 'Completed' ? `${score}%` : '-';
     };
 
+    // Helper to find the stored file of a report by type ('ai' or 'similarity')
+    const reportFile = (order, type) => {
+        const report = (order.reports || []).find((r) => r.type === type && r.file_path);
+        return report ? report.file_path : null;
+    };
+
     const handleDownload = async (filename) => {
         try {
             const response = await api.get(`/download/${filename}`, { responseType: 'blob' });
@@ -288,9 +294,9 @@ const Dashboard = () => {
                                             )}
                                         </td>
                                         <td style={{ padding: '12px' }}>
-                                            {file.status === 'Completed' && file.report2_path ? (
+                                            {file.status === 'Completed' && reportFile(file, 'ai') ? (
                                                 <button
-                                                    onClick={() => handleDownload(file.report2_path.split(/[/\\]/).pop())}
+                                                    onClick={() => handleDownload(reportFile(file, 'ai'))}
                                                     className="btn btn-outline"
                                                     style={{ padding: '4px 10px', fontSize: '0.85rem', display: 'inline-flex', alignItems: 'center', gap: '5px', cursor: 'pointer', backgroundColor: '#f0fdf4' }}
                                                 >
@@ -301,9 +307,9 @@ const Dashboard = () => {
                                             )}
                                         </td>
                                         <td style={{ padding: '12px' }}>
-                                            {file.status === 'Completed' && file.report1_path ? (
+                                            {file.status === 'Completed' && reportFile(file, 'similarity') ? (
                                                 <button
-                                                    onClick={() => handleDownload(file.report1_path.split(/[/\\]/).pop())}
+                                                    onClick={() => handleDownload(reportFile(file, 'similarity'))}
                                                     className="btn btn-outline"
                                                     style={{ padding: '4px 10px', fontSize: '0.85rem', display: 'inline-flex', alignItems: 'center', gap: '5px', cursor: 'pointer', backgroundColor: '#fef3f2' }}
                                                 >
@@ -12,7 +12,7 @@ import {
     X,
     FileText
 } from 'lucide-react';
-import { admin } from '../services/api';
+import { admin, auth, can, impersonating } from '../services/api';
 import NotificationToggle from './NotificationSetup';
 
 const SidebarItem = ({ icon: Icon, label, to, active, onClick }) => (
@@ -46,10 +46,25 @@ const DashboardLayout = () => {
         }
     }, []);
 
+    // Staff viewing the app as a customer
+    const impersonator = impersonating();
+    const impersonatedUser = impersonator ? JSON.parse(localStorage.getItem('user') || '{}') : null;
+
+    // Accounts that haven't verified their email can't buy slots yet
+    const unverified = !impersonator && JSON.parse(localStorage.getItem('user') || '{}').email_verified === false;
+
+    const handleStopImpersonating = async () => {
+        await admin.stopImpersonating();
+        window.location.href = '/dashboard/admin/users';
+    };
+
     const handleSignOut = (e) => {
         e.preventDefault();
-        localStorage.removeItem('token');
-        localStorage.removeItem('user');
+        if (impersonator) {
+            handleStopImpersonating();
+            return;
+        }
+        auth.logout();
         navigate('/login');
     };
 
@@ -80,27 +95,34 @@ const DashboardLayout = () => {
                     {isAdmin && (
                         <>
                             {/* ADDED ORDERS LINK */}
-                            <SidebarItem
-                                icon={FileText}
-                                label="Orders"
-                                to="/dashboard/admin/orders"
-                                active={location.pathname === '/dashboard/admin/orders'}
-                                onClick={() => setIsSidebarOpen(false)}
-                            />
-                            <SidebarItem
-                                icon={Users}
-                                label="Users"
-                                to="/dashboard/admin/users"
-                                active={location.pathname === '/dashboard/admin/users'}
-                                onClick={() => setIsSidebarOpen(false)}
-                            />
-                            <SidebarItem
-                                icon={Package}
-                                label="Packages"
-                                to="/dashboard/admin/packages"
-                                active={location.pathname === '/dashboard/admin/packages'}
-                                onClick={() => setIsSidebarOpen(false)}
-                            />
+                            {can('orders.view') && (
+                                <SidebarItem
+                                    icon={FileText}
+                                    label="Orders"
+                                    to="/dashboard/admin/orders"
+                                    active={location.pathname === '/dashboard/admin/orders'}
+                                    onClick={() => setIsSidebarOpen(false)}
+                                />
+                            )}
+                            {can('users.view') && (
+                                <SidebarItem
+                                    icon={Users}
+                                    label="Users"
+                                    to="/dashboard/admin/users"
+                                    active={location.pathname === '/dashboard/admin/users'}
+                                    onClick={() => setIsSidebarOpen(false)}
+                                />
+                            )}
+                            {can('packages.manage') && (
+                                <SidebarItem
+                                    icon={Package}
+                                    label="Packages"
+                                    to="/dashboard/admin/packages"
+                                    active={location.pathname === '/dashboard/admin/packages'}
+                                    onClick={() => setIsSidebarOpen(false)}
+                                />
+                            )}
+                            <SidebarItem icon={User} label="Account" to="/dashboard/account" active={location.pathname === '/dashboard/account'} onClick={() => setIsSidebarOpen(false)} />
                         </>
                     )}
 
@@ -114,12 +136,12 @@ const DashboardLayout = () => {
                 </nav>
 
                 <div className="sidebar-footer">
-                    {isAdmin && (
+                    {isAdmin && can('notifications.receive') && (
                         <NotificationToggle />
                     )}
                     <button onClick={handleSignOut} className="sidebar-item sign-out-btn">
                         <LogOut size={20} />
-                        <span>Sign Out</span>
+                        <span>{impersonator ? 'Stop Impersonating' : 'Sign Out'}</span>
                     </button>
                 </div>
             </aside>
@@ -131,6 +153,21 @@ const DashboardLayout = () => {
                     </button>
                     <span className="mobile-logo-text">Checkmate</span>
                 </div>
+                {impersonatedUser && (
+                    <div style={{ background: '#fef3c7', border: '1px solid #f59e0b', color: '#92400e', padding: '10px 16px', borderRadius: '8px', marginBottom: '16px', display: 'flex', justifyContent: 'space-between', alignItems: 'center', gap: '12px' }}>
+                        <span>
+                            Viewing as <strong>{impersonatedUser.email}</strong>
+                            {impersonatedUser.impersonation?.read_only ? ' (read-only)' : ''} — every action is logged.
+                        </span>
+                        <button className="btn" onClick={handleStopImpersonating}>Stop Impersonating</button>
+                    </div>
+                )}
+                {unverified && location.pathname !== '/dashboard/account' && (
+                    <div style={{ background: '#fef3c7', border: '1px solid #f59e0b', color: '#92400e', padding: '10px 16px', borderRadius: '8px', marginBottom: '16px', display: 'flex', justifyContent: 'space-between', alignItems: 'center', gap: '12px' }}>
+                        <span>Verify your email address to buy slots.</span>
+                        <Link to="/dashboard/account" className="btn">Verify Email</Link>
+                    </div>
+                )}
                 <Outlet />
             </main>
         </div>
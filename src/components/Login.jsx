@@ -1,14 +1,51 @@
-import React, { useState } from 'react';
-import { Link, useNavigate } from 'react-router-dom';
+import React, { useEffect, useState } from 'react';
+import { Link, useNavigate, useLocation } from 'react-router-dom';
 import { GoogleLogin } from '@react-oauth/google';
-import { auth } from '../services/api';
+import { auth, identities, storeSession } from '../services/api';
 
 const Login = () => {
     const navigate = useNavigate();
-    const [email, setEmail] = useState('');
+    const location = useLocation();
+    const [email, setEmail] = useState(location.state?.email || '');
     const [password, setPassword] = useState('');
-    const [error, setError] = useState('');
+    const [error, setError] = useState(location.state?.linkGoogle ? 'Sign in to your existing account to link Google.' : '');
     const [loading, setLoading] = useState(false);
+    const [message, setMessage] = useState('');
+    // Set when the account has two-factor authentication enabled
+    const [challenge, setChallenge] = useState(location.state?.challenge || '');
+    const [code, setCode] = useState('');
+    const [ssoProviders, setSsoProviders] = useState([]);
+    // Google credential to link once the user proves they own the existing account
+    const [pendingGoogle, setPendingGoogle] = useState(location.state?.linkGoogle || '');
+
+    const finishLogin = async (data) => {
+        if (data.two_factor_required) {
+            setChallenge(data.challenge);
+            return;
+        }
+        storeSession(data);
+        if (pendingGoogle) {
+            await identities.linkGoogle(pendingGoogle).catch(() => { });
+        }
+        if (data.user.is_admin) navigate('/dashboard/admin');
+        else navigate('/dashboard');
+    };
+
+    useEffect(() => {
+        auth.ssoProviders().then((res) => setSsoProviders(res.data || [])).catch(() => { });
+
+        // Returning from an identity provider: #sso_ticket=... or #sso_error=...
+        const params = new URLSearchParams(location.hash.slice(1));
+        if (params.get('sso_error')) setError(params.get('sso_error'));
+        const ticket = params.get('sso_ticket');
+        if (!ticket) return;
+        window.history.replaceState(null, '', location.pathname);
+        setLoading(true);
+        auth.ssoExchange(ticket)
+            .then((res) => finishLogin(res.data))
+            .catch((err) => setError(err.response?.data?.error || 'Sign-in failed'))
+            .finally(() => setLoading(false));
+    }, []);
 
     const handleLogin = async (e) => {
         e.preventDefault();
@@ -16,16 +53,7 @@ const Login = () => {
         setLoading(true);
         try {
             const response = await auth.login(email, password);
-            const { token, user } = response.data;
-
-            localStorage.setItem('token', token);
-            localStorage.setItem('user', JSON.stringify(user));
-
-            if (user.is_admin) {
-                navigate('/dashboard/admin');
-            } else {
-                navigate('/dashboard');
-            }
+            await finishLogin(response.data);
         } catch (err) {
             const serverError = err.response?.data?.error || err.message || 'Login failed';
             setError(serverError);
@@ -34,22 +62,93 @@ const Login = () => {
         }
     };
 
+    const handleMagicLink = async () => {
+        setError('');
+        setMessage('');
+        if (!email) {
+            setError('Enter your email address first');
+            return;
+        }
+        setLoading(true);
+        try {
+            const response = await auth.requestMagicLink(email);
+            setMessage(response.data.message);
+        } catch (err) {
+            setError(err.response?.data?.error || 'Failed to send sign-in link');
+        } finally {
+            setLoading(false);
+        }
+    };
+
     const handleGoogleSuccess = async (credentialResponse) => {
         setLoading(true);
         try {
             const response = await auth.googleLogin(credentialResponse.credential);
-            const { token, user } = response.data;
-            localStorage.setItem('token', token);
-            localStorage.setItem('user', JSON.stringify(user));
-            if (user.is_admin) navigate('/dashboard/admin');
-            else navigate('/dashboard');
+            await finishLogin(response.data);
         } catch (err) {
+            if (err.response?.data?.link_required) {
+                setPendingGoogle(credentialResponse.credential);
+                setEmail(err.response.data.email);
+            }
             setError(err.response?.data?.error || "Login Failed");
         } finally {
             setLoading(false);
         }
     };
 
+    const handleTwoFactor = async (e) => {
+        e.preventDefault();
+        setError('');
+        setLoading(true);
+        try {
+            const response = await auth.loginTwoFactor(challenge, code);
+            await finishLogin(response.data);
+        } catch (err) {
+            // 401 means the challenge itself expired: start over
+            if (err.response?.status === 401) setChallenge('');
+            setError(err.response?.data?.error || 'Verification failed');
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    if (challenge) {
+        return (
+            <div className="auth-container">
+                <div className="auth-card">
+                    <h2 className="auth-title">Two-Factor Authentication</h2>
+                    <p className="auth-subtitle">Enter the 6-digit code from your authenticator app, or one of your recovery codes.</p>
+
+                    {error && <div className="error-message">{error}</div>}
+
+                    <form className="auth-form" onSubmit={handleTwoFactor}>
+                        <div className="form-group">
+                            <label htmlFor="code">Authentication Code</label>
+                            <input
+                                type="text"
+                                id="code"
+                                className="form-control"
+                                placeholder="123456"
+                                autoComplete="one-time-code"
+                                value={code}
+                                onChange={(e) => setCode(e.target.value)}
+                                autoFocus
+                                required
+                            />
+                        </div>
+                        <button type="submit" className="btn btn-primary btn-block" disabled={loading}>
+                            {loading ? 'Verifying...' : 'Verify'}
+                        </button>
+                    </form>
+
+                    <div className="auth-footer">
+                        <a href="#" onClick={(e) => { e.preventDefault(); setChallenge(''); setCode(''); }}>Back to sign in</a>
+                    </div>
+                </div>
+            </div>
+        );
+    }
+
     return (
         <div className="auth-container">
             <div className="auth-card">
@@ -57,6 +156,7 @@ const Login = () => {
                 <p className="auth-subtitle">Sign in to continue to your account</p>
 
                 {error && <div className="error-message">{error}</div>}
+                {message && <div className="alert alert-success" style={{ textAlign: 'center', color: '#0d9488', marginBottom: '20px' }}>{message}</div>}
 
                 <form className="auth-form" onSubmit={handleLogin}>
                     <div className="form-group">
@@ -90,6 +190,9 @@ const Login = () => {
                     <button type="submit" className="btn btn-primary btn-block" disabled={loading}>
                         {loading ? 'Signing in...' : 'Sign In'}
                     </button>
+                    <button type="button" onClick={handleMagicLink} className="btn btn-outline btn-block" disabled={loading} style={{ marginTop: '0.75rem' }}>
+                        Email Me a Sign-In Link
+                    </button>
                 </form>
 
                 <div className="auth-divider"><span>or continue with</span></div>
@@ -104,6 +207,17 @@ const Login = () => {
                     />
                 </div>
 
+                {ssoProviders.map((provider) => (
+                    <a
+                        key={provider.id}
+                        href={auth.ssoStartURL(provider.id)}
+                        className="btn btn-outline btn-block"
+                        style={{ marginTop: '0.75rem' }}
+                    >
+                        Sign in with {provider.name}
+                    </a>
+                ))}
+
                 <div className="auth-footer">
                     Don't have an account? <Link to="/register">Create Account</Link>
                 </div>
@@ -0,0 +1,67 @@
+import React, { useState } from 'react';
+import { Link, useNavigate, useSearchParams } from 'react-router-dom';
+import { auth, storeSession } from '../services/api';
+
+const MagicLink = () => {
+    const [searchParams] = useSearchParams();
+    const token = searchParams.get('token');
+    const navigate = useNavigate();
+
+    const [error, setError] = useState('');
+    const [loading, setLoading] = useState(false);
+
+    // Signing in takes a click so email link scanners can't use up the link
+    const handleSignIn = async () => {
+        setError('');
+        setLoading(true);
+        try {
+            const response = await auth.magicLinkLogin(token);
+            if (response.data.two_factor_required) {
+                navigate('/login', { state: { challenge: response.data.challenge } });
+                return;
+            }
+            storeSession(response.data);
+            if (response.data.user.is_admin) navigate('/dashboard/admin');
+            else navigate('/dashboard');
+        } catch (err) {
+            setError(err.response?.data?.error || "This sign-in link is invalid or has expired.");
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    if (!token) {
+        return (
+            <div className="auth-container">
+                <div className="auth-card">
+                    <h2 className="auth-title">Invalid Link</h2>
+                    <p className="auth-subtitle">Missing sign-in token.</p>
+                    <div className="auth-footer">
+                        <Link to="/login">Back to Login</Link>
+                    </div>
+                </div>
+            </div>
+        );
+    }
+
+    return (
+        <div className="auth-container">
+            <div className="auth-card">
+                <h2 className="auth-title">Sign In</h2>
+                <p className="auth-subtitle">Continue to your Checkmate account.</p>
+
+                {error && <div className="error-message">{error}</div>}
+
+                <button onClick={handleSignIn} className="btn btn-primary btn-block" disabled={loading}>
+                    {loading ? 'Signing in...' : 'Continue'}
+                </button>
+
+                <div className="auth-footer">
+                    <Link to="/login">Back to Login</Link>
+                </div>
+            </div>
+        </div>
+    );
+};
+
+export default MagicLink;
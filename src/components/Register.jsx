@@ -1,7 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { Link, useNavigate } from 'react-router-dom';
 import { GoogleLogin } from '@react-oauth/google';
-import { auth } from '../services/api';
+import { auth, profile, storeSession } from '../services/api';
 
 const Register = () => {
     const navigate = useNavigate();
@@ -14,13 +14,19 @@ const Register = () => {
         confirmPassword: ''
     });
     const [otpCode, setOtpCode] = useState('');
+    const [account, setAccount] = useState(null);
     const [error, setError] = useState('');
     const [loading, setLoading] = useState(false);
+    const [minLength, setMinLength] = useState(8);
 
     // Resend Logic
     const [resendCount, setResendCount] = useState(0);
     const [timer, setTimer] = useState(0);
 
+    useEffect(() => {
+        auth.passwordPolicy().then(res => setMinLength(res.data.min_length)).catch(() => { });
+    }, []);
+
     useEffect(() => {
         let interval;
         if (timer > 0) {
@@ -43,14 +49,27 @@ const Register = () => {
             setError("Passwords don't match");
             return;
         }
+        if (formData.password.length < minLength) {
+            setError(`Password must be at least ${minLength} characters`);
+            return;
+        }
 
+        // The account is created (and signed in) straight away; the emailed
+        // code only verifies the address
         setLoading(true);
         try {
-            await auth.sendOTP(formData.email);
+            const response = await auth.signup({
+                first_name: formData.firstName,
+                last_name: formData.lastName,
+                email: formData.email,
+                password: formData.password
+            });
+            storeSession(response.data);
+            setAccount(response.data.user);
             setStep(2);
             setTimer(60); // Start cooldown immediately after first send
         } catch (err) {
-            setError(err.response?.data?.error || "Failed to send verification code");
+            setError(err.response?.data?.error || "Registration failed");
         } finally {
             setLoading(false);
         }
@@ -62,41 +81,32 @@ const Register = () => {
         setLoading(true);
         setError('');
         try {
-            await auth.sendOTP(formData.email);
+            await profile.sendVerification();
             setResendCount(prev => prev + 1);
             setTimer(60);
         } catch (err) {
-            setError("Failed to resend code");
+            setError(err.response?.data?.error || "Failed to resend code");
         } finally {
             setLoading(false);
         }
     };
 
+    const goToDashboard = () => {
+        if (account?.is_admin) navigate('/dashboard/admin');
+        else navigate('/dashboard');
+    };
+
     const handleCompleteRegister = async (e) => {
         e.preventDefault();
         setError('');
         setLoading(true);
 
         try {
-            await auth.signup({
-                first_name: formData.firstName,
-                last_name: formData.lastName,
-                email: formData.email,
-                password: formData.password,
-                code: otpCode
-            });
-
-            const loginResponse = await auth.login(formData.email, formData.password);
-            const { token, user } = loginResponse.data;
-
-            localStorage.setItem('token', token);
-            localStorage.setItem('user', JSON.stringify(user));
-
-            if (user.is_admin) navigate('/dashboard/admin');
-            else navigate('/dashboard');
-
+            await profile.confirmVerification(otpCode);
+            localStorage.setItem('user', JSON.stringify({ ...account, email_verified: true }));
+            goToDashboard();
         } catch (err) {
-            setError(err.response?.data?.error || "Registration failed. Invalid code?");
+            setError(err.response?.data?.error || "Verification failed. Invalid code?");
         } finally {
             setLoading(false);
         }
@@ -106,12 +116,20 @@ const Register = () => {
         setLoading(true);
         try {
             const response = await auth.googleLogin(credentialResponse.credential);
-            const { token, user } = response.data;
-            localStorage.setItem('token', token);
-            localStorage.setItem('user', JSON.stringify(user));
+            if (response.data.two_factor_required) {
+                navigate('/login', { state: { challenge: response.data.challenge } });
+                return;
+            }
+            const { user } = response.data;
+            storeSession(response.data);
             if (user.is_admin) navigate('/dashboard/admin');
             else navigate('/dashboard');
         } catch (err) {
+            // Existing account: sign in to it first, then Google gets linked
+            if (err.response?.data?.link_required) {
+                navigate('/login', { state: { email: err.response.data.email, linkGoogle: credentialResponse.credential } });
+                return;
+            }
             setError(err.response?.data?.error || "Login Failed");
         } finally {
             setLoading(false);
@@ -148,7 +166,7 @@ const Register = () => {
                         </div>
 
                         <button type="submit" className="btn btn-primary btn-block" disabled={loading}>
-                            {loading ? 'Activating...' : 'Activate Account'}
+                            {loading ? 'Verifying...' : 'Verify Email'}
                         </button>
 
                         <div style={{ marginTop: '20px', textAlign: 'center' }}>
@@ -165,17 +183,17 @@ const Register = () => {
                                     Resend Code {resendCount > 0 && `(${3 - resendCount} attempts left)`}
                                 </button>
                             ) : (
-                                <span style={{ color: '#ef4444', fontSize: '0.9rem' }}>Max attempts reached. Please restart.</span>
+                                <span style={{ color: '#ef4444', fontSize: '0.9rem' }}>Max attempts reached. You can resend it later from Account settings.</span>
                             )}
                         </div>
 
                         <button
                             type="button"
                             className="btn btn-link btn-block"
-                            onClick={() => setStep(1)}
+                            onClick={goToDashboard}
                             style={{ marginTop: '10px' }}
                         >
-                            ← Back to Register
+                            Skip for now (you can't buy slots until you verify)
                         </button>
                     </form>
                 </div>
@@ -201,6 +219,7 @@ const Register = () => {
                                 id="firstName"
                                 className="form-control"
                                 placeholder="John"
+                                value={formData.firstName}
                                 onChange={handleChange}
                                 required
                             />
@@ -212,6 +231,7 @@ const Register = () => {
                                 id="lastName"
                                 className="form-control"
                                 placeholder="Doe"
+                                value={formData.lastName}
                                 onChange={handleChange}
                                 required
                             />
@@ -225,6 +245,7 @@ const Register = () => {
                             id="email"
                             className="form-control"
                             placeholder="name@example.com"
+                            value={formData.email}
                             onChange={handleChange}
                             required
                         />
@@ -237,9 +258,12 @@ const Register = () => {
                             id="password"
                             className="form-control"
                             placeholder="Create a strong password"
+                            value={formData.password}
                             onChange={handleChange}
+                            minLength={minLength}
                             required
                         />
+                        <small style={{ color: '#6b7280' }}>At least {minLength} characters. Common or breached passwords are refused.</small>
                     </div>
                     <div className="form-group">
                         <label htmlFor="confirmPassword">Confirm Password</label>
@@ -248,6 +272,7 @@ const Register = () => {
                             id="confirmPassword"
                             className="form-control"
                             placeholder="Confirm your password"
+                            value={formData.confirmPassword}
                             onChange={handleChange}
                             required
                         />
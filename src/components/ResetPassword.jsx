@@ -1,4 +1,4 @@
-import React, { useState } from 'react';
+import React, { useState, useEffect } from 'react';
 import { Link, useNavigate, useSearchParams } from 'react-router-dom';
 import { auth } from '../services/api';
 
@@ -12,6 +12,11 @@ const ResetPassword = () => {
     const [message, setMessage] = useState('');
     const [error, setError] = useState('');
     const [loading, setLoading] = useState(false);
+    const [minLength, setMinLength] = useState(8);
+
+    useEffect(() => {
+        auth.passwordPolicy().then(res => setMinLength(res.data.min_length)).catch(() => { });
+    }, []);
 
     const handleSubmit = async (e) => {
         e.preventDefault();
@@ -67,8 +72,10 @@ const ResetPassword = () => {
                             className="form-control"
                             value={password}
                             onChange={(e) => setPassword(e.target.value)}
+                            minLength={minLength}
                             required
                         />
+                        <small style={{ color: '#6b7280' }}>At least {minLength} characters. Common or breached passwords are refused.</small>
                     </div>
                     <div className="form-group">
                         <label htmlFor="confirmPassword">Confirm Password</label>
@@ -23,17 +23,142 @@ api.interceptors.request.use(
     }
 );
 
+// Stores the tokens and user returned by login / refresh
+export const storeSession = ({ token, refresh_token, user }) => {
+    localStorage.setItem('token', token);
+    if (refresh_token) localStorage.setItem('refresh_token', refresh_token);
+    if (user) localStorage.setItem('user', JSON.stringify(user));
+};
+
+// Whether the signed-in staff member holds a permission ("*" grants all)
+export const can = (permission) => {
+    try {
+        const permissions = JSON.parse(localStorage.getItem('user') || '{}').permissions || [];
+        return permissions.includes('*') || permissions.includes(permission);
+    } catch (e) {
+        return false;
+    }
+};
+
+const clearSession = () => {
+    localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
+    localStorage.removeItem('user');
+};
+
+// While impersonating, the staff member's own session is parked under
+// "impersonator" and restored when they stop
+export const impersonating = () => {
+    try {
+        return JSON.parse(localStorage.getItem('impersonator') || 'null');
+    } catch (e) {
+        return null;
+    }
+};
+
+const restoreImpersonator = () => {
+    const saved = impersonating();
+    localStorage.removeItem('impersonator');
+    clearSession();
+    if (saved) storeSession(saved);
+};
+
+// Access tokens are short-lived: on a 401, swap the refresh token for a new
+// pair once and retry. Concurrent failures share a single refresh request.
+let refreshing = null;
+api.interceptors.response.use(
+    (response) => response,
+    async (error) => {
+        const original = error.config;
+        if (error.response?.status === 401 && impersonating()) {
+            // Impersonation tokens can't be refreshed: go back to the staff session
+            restoreImpersonator();
+            window.location.href = '/dashboard/admin/users';
+            return Promise.reject(error);
+        }
+        const refreshToken = localStorage.getItem('refresh_token');
+        if (error.response?.status !== 401 || !refreshToken || original._retried || original.url.startsWith('/auth/')) {
+            return Promise.reject(error);
+        }
+        original._retried = true;
+
+        try {
+            if (!refreshing) {
+                refreshing = axios.post(`${API_URL}/auth/refresh`, { refresh_token: refreshToken })
+                    .finally(() => { refreshing = null; });
+            }
+            const { data } = await refreshing;
+            storeSession(data);
+        } catch (refreshError) {
+            clearSession();
+            window.location.href = '/login';
+            return Promise.reject(refreshError);
+        }
+
+        original.headers['Authorization'] = `Bearer ${localStorage.getItem('token')}`;
+        return api(original);
+    }
+);
+
 export const auth = {
     login: (email, password) => api.post('/auth/login', { email, password }),
     signup: (userData) => api.post('/auth/signup', userData),
-    sendOTP: (email) => api.post('/auth/otp', { email }),
     googleLogin: (credential) => api.post('/auth/google', { credential }),
+    loginTwoFactor: (challenge, code) => api.post('/auth/login/2fa', { challenge, code }),
+    // Institutional single sign-on: the browser navigates to ssoStartURL and
+    // comes back to /login with a ticket to exchange
+    ssoProviders: () => api.get('/auth/oidc/providers'),
+    ssoStartURL: (provider) => `${API_URL}/auth/oidc/${provider}/start`,
+    ssoExchange: (ticket) => api.post('/auth/oidc/exchange', { ticket }),
+    requestMagicLink: (email) => api.post('/auth/magic-link', { email }),
+    magicLinkLogin: (token) => api.post('/auth/magic-link/verify', { token }),
     forgotPassword: (email) => api.post('/auth/forgot-password', { email }),
     resetPassword: (token, newPassword) => api.post('/auth/reset-password', { token, new_password: newPassword }),
+    passwordPolicy: () => api.get('/auth/password-policy'),
     logout: () => {
-        localStorage.removeItem('token');
-        localStorage.removeItem('user');
-    }
+        const refreshToken = localStorage.getItem('refresh_token');
+        clearSession();
+        if (refreshToken) return api.post('/auth/logout', { refresh_token: refreshToken }).catch(() => { });
+        return Promise.resolve();
+    },
+    logoutAll: () => api.post('/user/logout-all').finally(clearSession),
+};
+
+export const twoFactor = {
+    status: () => api.get('/user/2fa'),
+    setup: () => api.post('/user/2fa/setup'),
+    enable: (code) => api.post('/user/2fa/enable', { code }),
+    disable: (code) => api.post('/user/2fa/disable', { code }),
+    regenerateRecoveryCodes: (code) => api.post('/user/2fa/recovery-codes', { code }),
+};
+
+export const profile = {
+    get: () => api.get('/user/profile'),
+    update: (data) => api.put('/user/profile', data),
+    // Accounts without a password first get current_code_required and a code at their current address
+    requestEmailChange: (email, password, currentCode) => api.post('/user/profile/email', { email, password, current_code: currentCode }),
+    confirmEmailChange: (email, code) => api.post('/user/profile/email/confirm', { email, code }),
+    // Verifying the current address (new accounts, or after staff ask for it)
+    sendVerification: () => api.post('/user/verify-email'),
+    confirmVerification: (code) => api.post('/user/verify-email/confirm', { code }),
+    changePassword: (currentPassword, newPassword) => api.put('/user/profile/password', { current_password: currentPassword, new_password: newPassword }),
+    purchases: () => api.get('/user/profile/purchases'),
+    exportData: () => api.get('/user/export', { responseType: 'blob' }),
+    deleteAccount: (confirm, password) => api.delete('/user/account', { data: { confirm, password } }),
+};
+
+export const identities = {
+    list: () => api.get('/user/identities'),
+    linkGoogle: (credential) => api.post('/user/identities/google', { credential }),
+    setPassword: (password) => api.post('/user/identities/password', { password }),
+    // Returns the provider URL to navigate to; the browser comes back to /account
+    linkSso: (provider) => api.post(`/user/identities/oidc/${provider}`, null, { withCredentials: true }),
+    unlink: (id) => api.delete(`/user/identities/${id}`),
+};
+
+export const sessions = {
+    list: () => api.get('/user/sessions'),
+    revoke: (id) => api.delete(`/user/sessions/${id}`),
 };
 
 export const orders = {
@@ -45,11 +170,38 @@ export const orders = {
 
 export const admin = {
     list: () => api.get('/admin/orders'),
-    listUsers: () => api.get('/admin/users'),
+    listUsers: (params) => api.get('/admin/users', { params }),
+    getUser: (id) => api.get(`/admin/users/${id}`),
+    suspendUser: (id, reason) => api.post(`/admin/users/${id}/suspend`, { reason }),
+    unsuspendUser: (id) => api.post(`/admin/users/${id}/unsuspend`),
+    adjustSlots: (id, delta, reason) => api.post(`/admin/users/${id}/slots`, { delta, reason }),
+    sendPasswordReset: (id) => api.post(`/admin/users/${id}/reset-password`),
+    // View the app as a customer: swaps in a short-lived token until stopImpersonating
+    impersonate: async (id, reason, write = false) => {
+        const { data } = await api.post(`/admin/users/${id}/impersonate`, { reason, write });
+        localStorage.setItem('impersonator', JSON.stringify({
+            token: localStorage.getItem('token'),
+            refresh_token: localStorage.getItem('refresh_token'),
+            user: JSON.parse(localStorage.getItem('user') || 'null'),
+        }));
+        clearSession();
+        storeSession({ token: data.token, user: { ...data.user, impersonation: data.impersonation } });
+        return data;
+    },
+    stopImpersonating: () => api.post('/user/impersonation/end').catch(() => { }).finally(restoreImpersonator),
     transactions: () => api.get('/admin/transactions'),
     complete: (id, formData) => api.post(`/admin/complete/${id}`, formData),
     startProcessing: (id) => api.post(`/admin/processing/${id}`),
     verifyTransaction: (reference) => api.post(`/admin/transactions/${reference}/verify`),
+    // Roles & permissions
+    listRoles: () => api.get('/admin/roles'),
+    createRole: (data) => api.post('/admin/roles', data),
+    updateRole: (id, data) => api.put(`/admin/roles/${id}`, data),
+    deleteRole: (id) => api.delete(`/admin/roles/${id}`),
+    setUserRoles: (userId, roles) => api.put(`/admin/users/${userId}/roles`, { roles }),
+    // Audit log (filters: actor_id, action, target_type, target_id, ip, from, to)
+    audit: (params) => api.get('/admin/audit', { params }),
+    exportAudit: (params) => api.get('/admin/audit/export', { params, responseType: 'blob' }),
     // Notification endpoints
     getVapidKey: () => api.get('/admin/vapid-public-key'),
     subscribeNotifications: (subscription) => api.post('/admin/subscribe-notifications', { subscription }),